@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+// botReply is the output of a bot command: subject starts a thread, msg and details are posted into it
+type botReply struct {
+	subject string
+	msg     string
+	details string
+	// the Block Kit form of msg split into thread replies, if the command renders one
+	pages []*reportPage
+	// the notices to send to other channels, e.g. when findings are escalated
+	notices []escalationNotice
+}
+
+// botRequest is what a command needs to know about the message it was sent in, beyond the options it is run with
+type botRequest struct {
+	// the user who sent the command
+	requester string
+	// the positional arguments of the command
+	args []string
+	// whether the command overrides what counts as unhealthy, so its report no longer reflects the bot's settings
+	thresholdsOverridden bool
+}
+
+// botOption exposes one of a command's CLI flags to the bot under a short key, e.g. "min" for --oldest-minor
+type botOption struct {
+	key  string
+	flag string
+	// whether setting the option changes what counts as unhealthy, so the report no longer reflects the bot's settings
+	threshold bool
+}
+
+// botCommand is a command of the bot.  Its options are parsed by the same flag definitions the CLI uses, but only
+// the flags listed in options can be set from Slack.
+type botCommand struct {
+	name        string
+	description string
+	flags       func(flagset *pflag.FlagSet, o *options)
+	options     []botOption
+	// arguments describes the positional arguments of the command, which are kept in the request's args, if it takes
+	// any
+	arguments string
+	// the keys that must be given, and an example of the command using them
+	required []string
+	example  string
+	run      func(o *options, req *botRequest) *botReply
+}
+
+// botCommands returns the commands of the bot, in the order the help lists them
+func botCommands() []*botCommand {
+	return []*botCommand{
+		{
+			name:        "help",
+			description: "this help text",
+			flags:       func(flagset *pflag.FlagSet, o *options) {},
+			run:         func(o *options, req *botRequest) *botReply { return &botReply{subject: botHelp(o)} },
+		},
+		{
+			name:        "report",
+			description: "Generates human reports about which release streams do not have recently built or recently accepted payloads, based on the release info found at https://amd64.ocp.releases.ci.openshift.org/ or the equivalent page for the architecture specified in the request.",
+			flags: func(flagset *pflag.FlagSet, o *options) {
+				addSharedFlags(flagset, o)
+				flagset.BoolVar(&o.tag, "tag", false, "Tag the --slack-alias group with the report output")
+			},
+			options: []botOption{
+				{key: "min", flag: "oldest-minor"},
+				{key: "max", flag: "newest-minor"},
+				{key: "arch", flag: "arch"},
+				{key: "streams", flag: "streams"},
+				{key: "accepted", flag: "accepted-staleness-limit", threshold: true},
+				{key: "built", flag: "built-staleness-limit", threshold: true},
+				{key: "upgrade", flag: "upgrade-staleness-limit", threshold: true},
+				{key: "healthy", flag: "include-healthy"},
+				{key: "changelog", flag: "include-changelog"},
+				{key: "cadence", flag: "check-release-cadence"},
+				{key: "business-time", flag: "business-time", threshold: true},
+				{key: "tag", flag: "tag"},
+			},
+			run: runReportCommand,
+		},
+		{
+			name:        "jobs",
+			description: "Ranks the blocking jobs that caused the most payload rejections in a release stream.",
+			flags:       addJobsFlags,
+			options: []botOption{
+				{key: "stream", flag: "stream"},
+				{key: "window", flag: "window"},
+				{key: "arch", flag: "arch"},
+			},
+			required: []string{"stream"},
+			example:  "jobs stream=4.16.0-0.nightly",
+			run:      runJobsCommand,
+		},
+		{
+			name:        "readiness",
+			description: "Checks whether a candidate nightly is ready to be cut as a z release: it must be accepted and have successful upgrades from the latest shipped z of its minor and of the previous minor.",
+			flags: func(flagset *pflag.FlagSet, o *options) {
+				addReadinessFlags(flagset, o)
+				flagset.StringVar(&o.candidate, "release", "", "A minor, e.g. 4.16 to check its newest accepted nightly, or a specific nightly payload")
+			},
+			options: []botOption{
+				{key: "release", flag: "release"},
+				{key: "arch", flag: "arch"},
+				{key: "upgrade", flag: "upgrade-staleness-limit"},
+			},
+			required: []string{"release"},
+			example:  "readiness release=4.16",
+			run:      runReadinessCommand,
+		},
+		{
+			name:        "ack",
+			arguments:   "[MINOR TYPE | STREAM]",
+			description: "Acknowledges the findings of a stream, e.g. *ack 4.16 nightly* or *ack 4.16.0-0.nightly-arm64*, which pauses their escalation until they change.  Without a stream, lists the unhealthy streams and who acknowledged them.",
+			flags: func(flagset *pflag.FlagSet, o *options) {
+				flagset.StringVar(&o.arch, "arch", "amd64", "Which architecture the stream is on (amd64, arm64)")
+			},
+			options: []botOption{
+				{key: "arch", flag: "arch"},
+			},
+			run: runAckCommand,
+		},
+	}
+}
+
+// flagSet registers the command's flags for a copy of the bot's options, which keeps the settings the bot was started
+// with as defaults
+func (c *botCommand) flagSet(o *options) (*pflag.FlagSet, *options) {
+	flagset := pflag.NewFlagSet(c.name, pflag.ContinueOnError)
+	flagset.SetOutput(io.Discard)
+	opts := &options{}
+	c.flags(flagset, opts)
+	// registering the flags reset their values to the CLI defaults, so restore the bot's settings in place, where the
+	// flags still point
+	*opts = *o
+	return flagset, opts
+}
+
+func (c *botCommand) option(key string) *botOption {
+	for i := range c.options {
+		if c.options[i].key == key {
+			return &c.options[i]
+		}
+	}
+	return nil
+}
+
+// parseCommand parses a command such as `report min=14 accepted=48h healthy`, returning the command, the options to
+// run it with and the request it makes
+func (o *options) parseCommand(text string) (*botCommand, *options, *botRequest, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(tokens) == 0 {
+		tokens = []string{"help"}
+	}
+
+	// Slack capitalizes the first word of a message on some devices
+	tokens[0] = strings.ToLower(tokens[0])
+	var command *botCommand
+	for _, c := range botCommands() {
+		if c.name == tokens[0] {
+			command = c
+		}
+	}
+	if command == nil {
+		return nil, nil, nil, fmt.Errorf("unknown command `%s`, see *help* for the commands", tokens[0])
+	}
+
+	flagset, opts := command.flagSet(o)
+	req := &botRequest{}
+	given := make(map[string]struct{})
+	for _, token := range tokens[1:] {
+		key, value, hasValue := strings.Cut(token, "=")
+		option := command.option(key)
+		if option == nil && !hasValue && command.arguments != "" {
+			req.args = append(req.args, token)
+			continue
+		}
+		if option == nil {
+			return nil, nil, nil, fmt.Errorf("unknown argument `%s` for the %s command, see *help* for its arguments", token, command.name)
+		}
+		flag := flagset.Lookup(option.flag)
+		if !hasValue {
+			// boolean options may be given as a bare word to turn them on
+			if flag.Value.Type() != "bool" {
+				return nil, nil, nil, fmt.Errorf("argument `%s` needs a value, e.g. `%s=X`", token, key)
+			}
+			value = "true"
+		}
+		if err := flagset.Set(option.flag, value); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid value in `%s`: %v", token, err)
+		}
+		given[key] = struct{}{}
+		if option.threshold {
+			req.thresholdsOverridden = true
+		}
+	}
+	for _, key := range command.required {
+		if _, ok := given[key]; !ok {
+			return nil, nil, nil, fmt.Errorf("the %s command requires `%s=X`, e.g. *%s*", command.name, key, command.example)
+		}
+	}
+	return command, opts, req, nil
+}
+
+// tokenize splits text on whitespace, keeping quoted values together, e.g. `stream="4.16.0-0.nightly"`.  Slack
+// replaces straight quotes with curly ones as they are typed, so those are accepted too.
+func tokenize(text string) ([]string, error) {
+	text = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+	tokens := []string{}
+	var current strings.Builder
+	inToken := false
+	var quote rune
+	for _, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote || (quote == '“' && r == '”') || (quote == '‘' && r == '’') {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'' || r == '“' || r == '‘':
+			quote, inToken = r, true
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in `%s`", current.String())
+	}
+	if inToken {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
+
+// botHelp describes every command and its arguments, generated from the same flag definitions the commands parse
+func botHelp(o *options) string {
+	output := ""
+	for _, command := range botCommands() {
+		usage := command.name
+		if command.arguments != "" {
+			usage += " " + command.arguments
+		}
+		output += fmt.Sprintf("*%s* - %s\n", usage, command.description)
+		if len(command.options) == 0 {
+			continue
+		}
+		flagset, _ := command.flagSet(o)
+		output += "Arguments:\n"
+		for _, option := range command.options {
+			flag := flagset.Lookup(option.flag)
+			usage := flag.Usage
+			for _, key := range command.required {
+				if key == option.key {
+					usage += " (required)"
+				}
+			}
+			if flag.Value.Type() == "bool" {
+				output += fmt.Sprintf("  *%s* or *%s=false* - %s (currently *%s*)\n", option.key, option.key, usage, flag.Value)
+				continue
+			}
+			if current := flag.Value.String(); current != "" && current != "-1" {
+				usage += fmt.Sprintf(" (currently *%s*)", current)
+			}
+			output += fmt.Sprintf("  *%s=X* - %s\n", option.key, usage)
+		}
+	}
+	output += "Values can be quoted, e.g. *stream=\"4.16.0-0.nightly\"*"
+	return output
+}
+
+func runReportCommand(o *options, req *botRequest) *botReply {
+	reply := &botReply{}
+	rep, err := generateReport(o)
+	if err != nil {
+		reply.subject = fmt.Sprintf("Sorry, an error occurred generating the report: %v", err)
+		return reply
+	}
+	numUnhealthy, numLowSeverity := rep.unhealthyCounts()
+	reply.subject = fmt.Sprintf("Latest payload stream health report thread for `%s`, `v4.%d` to `v4.%d` (%d of %d streams unhealthy)", o.arch, rep.oldestMinor, rep.newestMinor, numUnhealthy, len(rep.streams))
+	if numLowSeverity > 0 {
+		reply.subject += fmt.Sprintf(", %d of them low severity", numLowSeverity)
+	}
+	if rep.alertOnGAEdgeRemoval && rep.gaEdgesRemoved() {
+		reply.subject += ", upgrade edges were removed from generally available releases"
+	}
+	reply.details = rep.changelogDetails()
+
+	// the alias and the owners are only tagged when asked to, so routine reports do not ping anyone
+	mention := ""
+	if o.tag && o.config.QuietHours.active(time.Now()) {
+		mention = "It is quiet hours, so nobody is tagged."
+	} else if o.tag {
+		alias := fmt.Sprintf("<!subteam^%s>", patchManagerId)
+		if o.slackAlias != "" {
+			alias = o.groupMention(o.slackAlias)
+		}
+		if o.includeHealthy {
+			mention = fmt.Sprintf("%s here is the latest payload health report", alias)
+		} else {
+			mention = fmt.Sprintf("%s here are the currently unhealthy payload streams that need investigation:", alias)
+		}
+		if owners := rep.mentionOwners(o.config, o.groupMention); len(owners) > 0 {
+			mention = fmt.Sprintf("%s\nOwners of the unhealthy findings: %s", mention, strings.Join(owners, " "))
+		}
+	}
+	// a report with overridden thresholds does not reflect the health the escalations track, so it leaves them be
+	if o.escalations != nil && !req.thresholdsOverridden {
+		notices, escalated, err := o.escalations.update(rep, o.config.Escalations, time.Now(), !o.config.QuietHours.active(time.Now()), o.groupMention)
+		if err != nil {
+			klog.Errorf("unable to save the escalation state: %v", err)
+		}
+		if len(escalated) > 0 {
+			mention = strings.TrimSpace(fmt.Sprintf("%s\nEscalated to: %s", mention, strings.Join(escalated, " ")))
+		}
+		reply.notices = notices
+	}
+	// the report is rendered again so its findings carry their owners
+	reply.msg = rep.String(o.includeHealthy)
+	if mention != "" {
+		reply.msg = fmt.Sprintf("%s\n\n%s", mention, reply.msg)
+	}
+	reply.pages = rep.pages(o, o.includeHealthy, mention)
+	return reply
+}
+
+func runJobsCommand(o *options, req *botRequest) *botReply {
+	rep, err := generateJobsReport(o.stream, o.window, o.arch)
+	if err != nil {
+		return &botReply{subject: fmt.Sprintf("Sorry, an error occurred generating the job failure report: %v", err)}
+	}
+	return &botReply{
+		subject: fmt.Sprintf("Blocking job failure ranking for `%s` on `%s` (%d of %d payloads rejected)", rep.stream, o.arch, rep.rejected, rep.payloads),
+		msg:     rep.String(),
+	}
+}
+
+func runReadinessCommand(o *options, req *botRequest) *botReply {
+	rep, err := generateReadinessReport(o.candidate, o.arch, o.upgradeStalenessLimit)
+	if err != nil {
+		return &botReply{subject: fmt.Sprintf("Sorry, an error occurred checking readiness: %v", err)}
+	}
+	return &botReply{
+		subject: fmt.Sprintf("Z release readiness of `%s` on `%s`: *%s*", rep.payload, o.arch, rep.verdict()),
+		msg:     rep.String(),
+	}
+}
+
+func runAckCommand(o *options, req *botRequest) *botReply {
+	if o.escalations == nil {
+		return &botReply{subject: "Sorry, no escalation policy is configured"}
+	}
+	if len(req.args) == 0 {
+		state := o.escalations.String()
+		if state == "" {
+			return &botReply{subject: "No unhealthy streams are being tracked"}
+		}
+		return &botReply{subject: "Unhealthy streams being tracked for escalation", msg: state}
+	}
+	stream, err := ackStream(req.args, o.arch)
+	if err != nil {
+		return &botReply{subject: fmt.Sprintf("Sorry, I couldn't process that request: %v", err)}
+	}
+	found, err := o.escalations.acknowledge(stream, req.requester, time.Now())
+	if err != nil {
+		klog.Errorf("unable to save the escalation state: %v", err)
+	}
+	if !found {
+		return &botReply{subject: fmt.Sprintf("`%s` has no unhealthy findings to acknowledge", stream)}
+	}
+	return &botReply{subject: fmt.Sprintf("<@%s> acknowledged the findings of `%s`, escalation is paused until they change", req.requester, stream)}
+}
+
+// ackStream returns the stream named by the arguments of the ack command: either a minor and a stream type, e.g.
+// `4.16 nightly`, or a stream name.  Names are given as on amd64 and suffixed for the requested architecture.
+func ackStream(args []string, arch string) (string, error) {
+	var stream string
+	switch {
+	case len(args) == 2 && minorOnlyRegex.MatchString(args[0]) && (args[1] == "nightly" || args[1] == "ci"):
+		stream = fmt.Sprintf("%s.0-0.%s", args[0], args[1])
+	case len(args) == 1:
+		stream = args[0]
+	default:
+		return "", fmt.Errorf("`ack %s` does not name a stream, use e.g. *ack 4.16 nightly* or *ack 4.16.0-0.nightly*", strings.Join(args, " "))
+	}
+	if arch != "amd64" && !strings.HasSuffix(stream, "-"+arch) {
+		stream = siblingStream(stream, "amd64", arch)
+	}
+	return stream, nil
+}
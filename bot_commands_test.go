@@ -0,0 +1,223 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+		err      string
+	}{
+		{
+			name:     "empty",
+			text:     "",
+			expected: []string{},
+		},
+		{
+			name:     "whitespace is collapsed",
+			text:     "  report \t min=14\n healthy ",
+			expected: []string{"report", "min=14", "healthy"},
+		},
+		{
+			name:     "straight quotes keep a value together",
+			text:     `report streams="4.16 nightly"`,
+			expected: []string{"report", "streams=4.16 nightly"},
+		},
+		{
+			name:     "single quotes keep a value together",
+			text:     `report streams='4.16 nightly'`,
+			expected: []string{"report", "streams=4.16 nightly"},
+		},
+		{
+			name:     "curly quotes as typed in Slack",
+			text:     "report streams=“4.16 nightly”",
+			expected: []string{"report", "streams=4.16 nightly"},
+		},
+		{
+			name:     "empty quoted value",
+			text:     `report streams=""`,
+			expected: []string{"report", "streams="},
+		},
+		{
+			name:     "html entities are unescaped",
+			text:     "report streams=4.1[0-9]&amp;&gt;",
+			expected: []string{"report", "streams=4.1[0-9]&>"},
+		},
+		{
+			name: "unterminated quote",
+			text: `report streams="4.16`,
+			err:  "unterminated quote",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens, err := tokenize(tc.text)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected an error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tokens, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, tokens)
+			}
+		})
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	defaults := &options{
+		oldestMinor:            -1,
+		newestMinor:            -1,
+		arch:                   "amd64",
+		acceptedStalenessLimit: 24 * time.Hour,
+		builtStalenessLimit:    72 * time.Hour,
+		upgradeStalenessLimit:  72 * time.Hour,
+	}
+	testCases := []struct {
+		name    string
+		text    string
+		command string
+		check   func(t *testing.T, o *options, req *botRequest)
+		err     string
+	}{
+		{
+			name:    "no command is help",
+			text:    "",
+			command: "help",
+		},
+		{
+			name:    "command name is not case sensitive",
+			text:    "Report",
+			command: "report",
+		},
+		{
+			name:    "options keep the bot's settings as defaults",
+			text:    "report min=14",
+			command: "report",
+			check: func(t *testing.T, o *options, req *botRequest) {
+				if o.oldestMinor != 14 || o.newestMinor != -1 || o.acceptedStalenessLimit != 24*time.Hour {
+					t.Errorf("unexpected options: min=%d max=%d accepted=%s", o.oldestMinor, o.newestMinor, o.acceptedStalenessLimit)
+				}
+				if req.thresholdsOverridden {
+					t.Error("expected the thresholds to be left as they are")
+				}
+			},
+		},
+		{
+			name:    "bare booleans turn options on",
+			text:    "report healthy tag",
+			command: "report",
+			check: func(t *testing.T, o *options, req *botRequest) {
+				if !o.includeHealthy || !o.tag {
+					t.Errorf("expected healthy and tag to be set, got healthy=%t tag=%t", o.includeHealthy, o.tag)
+				}
+			},
+		},
+		{
+			name:    "booleans can be turned off",
+			text:    "report healthy=false",
+			command: "report",
+			check: func(t *testing.T, o *options, req *botRequest) {
+				if o.includeHealthy {
+					t.Error("expected healthy to be unset")
+				}
+			},
+		},
+		{
+			name:    "durations",
+			text:    "report accepted=48h",
+			command: "report",
+			check: func(t *testing.T, o *options, req *botRequest) {
+				if o.acceptedStalenessLimit != 48*time.Hour {
+					t.Errorf("expected an accepted limit of 48h, got %s", o.acceptedStalenessLimit)
+				}
+				if !req.thresholdsOverridden {
+					t.Error("expected the thresholds to be overridden")
+				}
+			},
+		},
+		{
+			name:    "positional arguments",
+			text:    "ack 4.16 nightly arch=arm64",
+			command: "ack",
+			check: func(t *testing.T, o *options, req *botRequest) {
+				if !reflect.DeepEqual(req.args, []string{"4.16", "nightly"}) || o.arch != "arm64" {
+					t.Errorf("unexpected arguments %q on %s", req.args, o.arch)
+				}
+			},
+		},
+		{
+			name: "unknown command",
+			text: "deploy",
+			err:  "unknown command `deploy`",
+		},
+		{
+			name: "unknown key",
+			text: "report minimum=14",
+			err:  "unknown argument `minimum=14`",
+		},
+		{
+			name: "bare word without positional arguments",
+			text: "report 4.16",
+			err:  "unknown argument `4.16`",
+		},
+		{
+			name: "bare non-boolean",
+			text: "report min",
+			err:  "argument `min` needs a value",
+		},
+		{
+			name: "invalid value",
+			text: "report accepted=soon",
+			err:  "invalid value in `accepted=soon`",
+		},
+		{
+			name: "missing required key",
+			text: "jobs window=24h",
+			err:  "the jobs command requires `stream=X`",
+		},
+		{
+			name:    "required key given",
+			text:    "jobs stream=4.16.0-0.nightly",
+			command: "jobs",
+			check: func(t *testing.T, o *options, req *botRequest) {
+				if o.stream != "4.16.0-0.nightly" {
+					t.Errorf("expected the stream to be set, got %q", o.stream)
+				}
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			command, o, req, err := defaults.parseCommand(tc.text)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected an error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if command.name != tc.command {
+				t.Errorf("expected the %s command, got %s", tc.command, command.name)
+			}
+			if tc.check != nil {
+				tc.check(t, o, req)
+			}
+			if defaults.oldestMinor != -1 || defaults.includeHealthy {
+				t.Error("parsing changed the bot's settings")
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// the streams that hold shipped releases, named for amd64.  Other architectures suffix them (e.g. 4-stable-arm64).
+	stableStream     = "4-stable"
+	devPreviewStream = "4-dev-preview"
+)
+
+// shippedRelease is a named release found on the stable or dev-preview streams
+type shippedRelease struct {
+	version string
+	stream  string
+}
+
+// getShippedReleases returns the accepted named releases of the stable and dev-preview streams, grouped by minor.  A
+// stream that cannot be read does not stop the other from being read: its error is returned keyed by the stream.
+func getShippedReleases(releaseAPIUrl, arch string) (map[int][]shippedRelease, map[string]error) {
+	shipped := make(map[int][]shippedRelease)
+	failed := make(map[string]error)
+	for _, stream := range []string{siblingStream(stableStream, "amd64", arch), siblingStream(devPreviewStream, "amd64", arch)} {
+		tags, err := getReleaseStreamTags(releaseAPIUrl, stream)
+		if err != nil {
+			failed[stream] = err
+			continue
+		}
+		for _, tag := range tags.Tags {
+			if tag.Phase != phaseAccepted {
+				continue
+			}
+			m := namedVersionRegex.FindStringSubmatch(tag.Name)
+			if m == nil {
+				continue
+			}
+			minor, _ := strconv.Atoi(m[1])
+			shipped[minor] = append(shipped[minor], shippedRelease{version: tag.Name, stream: stream})
+		}
+	}
+	for minor := range shipped {
+		releases := shipped[minor]
+		sort.Slice(releases, func(i, j int) bool { return namedVersionLess(releases[j].version, releases[i].version) })
+	}
+	return shipped, failed
+}
+
+// checkReleaseCadence reports, for every minor in the range, how long ago the last z release shipped, or for minors
+// still in development how long ago the last engineering or release candidate shipped.  Each z release shipped within
+// the cadence threshold must also have a successful upgrade edge from its predecessor in the stable graph.  Only the
+// minors the selector selects are checked.  A stream that cannot be read is reported as unhealthy, and the minors that
+// do not depend on it are still checked.
+func checkReleaseCadence(rep *report, cfg *config, releaseAPIUrl, arch string, graph GraphMap, oldestMinor, newestMinor int, selector *streamSelector, phases map[int]string) {
+	shipped, failed := getShippedReleases(releaseAPIUrl, arch)
+	addMessage := func(stream string, minor int, healthy bool, msg string) {
+		if _, ok := rep.streams[stream]; !ok {
+			rep.streams[stream] = &releaseReport{}
+		}
+		if healthy {
+			rep.streams[stream].healthyMessages = append(rep.streams[stream].healthyMessages, msg)
+		} else {
+			rep.streams[stream].addUnhealthy(checkCadence, minor, msg)
+		}
+	}
+
+	for stream, err := range failed {
+		klog.Errorf("unable to read %s to check the release cadence: %v", stream, err)
+		addMessage(stream, -1, false, fmt.Sprintf("Unable to read the stream to check the release cadence: %v", err))
+	}
+	// without the stable stream every minor would look like it has not shipped yet
+	if _, ok := failed[siblingStream(stableStream, "amd64", arch)]; ok {
+		return
+	}
+	_, devPreviewFailed := failed[siblingStream(devPreviewStream, "amd64", arch)]
+
+	now := time.Now()
+	for minor := newestMinor; minor >= oldestMinor; minor-- {
+		if !selector.selectsMinor(minor, phases[minor]) {
+			continue
+		}
+		ga := []shippedRelease{}
+		candidates := []shippedRelease{}
+		for _, release := range shipped[minor] {
+			if gaVersionRegex.MatchString(release.version) {
+				ga = append(ga, release)
+			} else {
+				candidates = append(candidates, release)
+			}
+		}
+
+		if len(ga) == 0 {
+			if devPreviewFailed {
+				continue
+			}
+			threshold := cfg.cadenceThreshold(cadencePhaseDevelopment)
+			if len(candidates) == 0 {
+				addMessage(siblingStream(devPreviewStream, "amd64", arch), minor, true, fmt.Sprintf("4.%d: No engineering or release candidate has shipped yet", minor))
+				continue
+			}
+			latest := candidates[0]
+			created, err := getPayloadCreated(releaseAPIUrl, latest.stream, latest.version)
+			if err != nil {
+				klog.Errorf("unable to determine when %s shipped: %v", latest.version, err)
+				continue
+			}
+			age := now.Sub(created)
+			if age > threshold {
+				addMessage(latest.stream, minor, false, fmt.Sprintf("4.%d: Most recent candidate %s shipped %.1f days ago, more than %.1f days for a release in development", minor, latest.version, age.Hours()/24, threshold.Hours()/24))
+			} else {
+				addMessage(latest.stream, minor, true, fmt.Sprintf("4.%d: Most recent candidate %s shipped %.1f days ago", minor, latest.version, age.Hours()/24))
+			}
+			continue
+		}
+
+		threshold := cfg.cadenceThreshold(phases[minor], cadencePhaseSupported)
+		phase := "a supported release"
+		if phases[minor] != "" {
+			phase = "a release in " + phases[minor]
+		}
+		for i, release := range ga {
+			created, err := getPayloadCreated(releaseAPIUrl, release.stream, release.version)
+			if err != nil {
+				klog.Errorf("unable to determine when %s shipped: %v", release.version, err)
+				break
+			}
+			age := now.Sub(created)
+			if i == 0 {
+				if age > threshold {
+					addMessage(release.stream, minor, false, fmt.Sprintf("4.%d: Most recent z release %s shipped %.1f days ago, more than %.1f days for %s", minor, release.version, age.Hours()/24, threshold.Hours()/24, phase))
+				} else {
+					addMessage(release.stream, minor, true, fmt.Sprintf("4.%d: Most recent z release %s shipped %.1f days ago", minor, release.version, age.Hours()/24))
+				}
+			} else if age > threshold {
+				// only the newly shipped z releases need their upgrade edges checked
+				break
+			}
+			if i+1 >= len(ga) {
+				break
+			}
+			predecessor := ga[i+1].version
+			hasEdge := false
+			for _, from := range graph[release.version] {
+				if from == predecessor {
+					hasEdge = true
+					break
+				}
+			}
+			if hasEdge {
+				addMessage(release.stream, minor, true, fmt.Sprintf("4.%d: %s has a successful upgrade from its predecessor %s", minor, release.version, predecessor))
+			} else {
+				addMessage(release.stream, minor, false, fmt.Sprintf("4.%d: %s does not have a successful upgrade from its predecessor %s", minor, release.version, predecessor))
+			}
+		}
+	}
+}
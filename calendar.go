@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// freezeSuppress removes the findings of frozen streams from the report
+	freezeSuppress = "suppress"
+	// freezeDowngrade keeps the findings of frozen streams but lowers their severity
+	freezeDowngrade = "downgrade"
+)
+
+var (
+	defaultWeekends = []string{"Saturday", "Sunday"}
+)
+
+// calendar declares when the release streams are expected to go quiet: weekends, company holidays and release freezes
+type calendar struct {
+	// Location is the time zone the calendar is kept in, e.g. "America/New_York" (default UTC)
+	Location string `json:"location,omitempty"`
+	// Weekends are the days of the week that are not business days (default Saturday and Sunday)
+	Weekends []string `json:"weekends,omitempty"`
+	// Holidays are the dates, e.g. "2026-12-25", that are not business days
+	Holidays []string `json:"holidays,omitempty"`
+	// FreezeWindows are the release freezes during which findings are suppressed or downgraded
+	FreezeWindows []freezeWindow `json:"freezeWindows,omitempty"`
+
+	location *time.Location
+	weekends map[time.Weekday]struct{}
+	holidays map[string]struct{}
+}
+
+// freezeWindow is a declared release freeze, covering its start and end dates
+type freezeWindow struct {
+	// Minors restricts the window to the given minors, e.g. ["4.16"], all minors when empty
+	Minors []string `json:"minors,omitempty"`
+	Start  string   `json:"start"`
+	End    string   `json:"end"`
+	// Action is either "downgrade" (default) or "suppress"
+	Action string `json:"action,omitempty"`
+	// Reason is shown in the report when the window applied, e.g. "holiday freeze"
+	Reason string `json:"reason,omitempty"`
+
+	minors map[int]struct{}
+	start  time.Time
+	end    time.Time
+}
+
+// complete fills in defaults and validates the calendar
+func (c *calendar) complete() error {
+	c.location = time.UTC
+	if c.Location != "" {
+		location, err := time.LoadLocation(c.Location)
+		if err != nil {
+			return fmt.Errorf("calendar has an unknown location %q: %w", c.Location, err)
+		}
+		c.location = location
+	}
+
+	if len(c.Weekends) == 0 {
+		c.Weekends = defaultWeekends
+	}
+	c.weekends = make(map[time.Weekday]struct{}, len(c.Weekends))
+	for _, name := range c.Weekends {
+		day, ok := parseWeekday(name)
+		if !ok {
+			return fmt.Errorf("calendar has an unknown weekend day %q", name)
+		}
+		c.weekends[day] = struct{}{}
+	}
+
+	c.holidays = make(map[string]struct{}, len(c.Holidays))
+	for _, date := range c.Holidays {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("holiday %q must be formatted as YYYY-MM-DD: %w", date, err)
+		}
+		c.holidays[date] = struct{}{}
+	}
+
+	for i := range c.FreezeWindows {
+		window := &c.FreezeWindows[i]
+		var err error
+		if window.start, err = time.ParseInLocation("2006-01-02", window.Start, c.location); err != nil {
+			return fmt.Errorf("freeze window %d start must be formatted as YYYY-MM-DD: %w", i, err)
+		}
+		if window.end, err = time.ParseInLocation("2006-01-02", window.End, c.location); err != nil {
+			return fmt.Errorf("freeze window %d end must be formatted as YYYY-MM-DD: %w", i, err)
+		}
+		if window.end.Before(window.start) {
+			return fmt.Errorf("freeze window %d ends before it starts", i)
+		}
+		// the end date is included in the window
+		window.end = window.end.AddDate(0, 0, 1)
+		switch window.Action {
+		case "":
+			window.Action = freezeDowngrade
+		case freezeDowngrade, freezeSuppress:
+		default:
+			return fmt.Errorf("freeze window %d has unknown action %q, must be %q or %q", i, window.Action, freezeDowngrade, freezeSuppress)
+		}
+		window.minors = make(map[int]struct{}, len(window.Minors))
+		for _, version := range window.Minors {
+			m := minorOnlyRegex.FindStringSubmatch(version)
+			if m == nil {
+				return fmt.Errorf("freeze window %d minor %q must be a minor such as \"4.16\"", i, version)
+			}
+			minor, _ := strconv.Atoi(m[1])
+			window.minors[minor] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), name) || strings.EqualFold(day.String()[:3], name) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// businessDay reports whether the day containing t is neither a weekend nor a holiday
+func (c *calendar) businessDay(t time.Time) bool {
+	t = t.In(c.location)
+	if _, ok := c.weekends[t.Weekday()]; ok {
+		return false
+	}
+	_, holiday := c.holidays[t.Format("2006-01-02")]
+	return !holiday
+}
+
+// businessTime is how much of the time between from and to fell on business days
+func (c *calendar) businessTime(from, to time.Time) time.Duration {
+	// a zero time stands for an unknown timestamp, which would otherwise be walked day by day from year 1
+	if from.IsZero() || to.IsZero() {
+		return to.Sub(from)
+	}
+	var elapsed time.Duration
+	for day := from.In(c.location); day.Before(to); {
+		y, m, d := day.Date()
+		next := time.Date(y, m, d+1, 0, 0, 0, 0, c.location)
+		end := next
+		if to.Before(end) {
+			end = to
+		}
+		if c.businessDay(day) {
+			elapsed += end.Sub(day)
+		}
+		day = next
+	}
+	return elapsed
+}
+
+// elapsedFunc returns how payload ages are measured: in business time when requested and a calendar is configured,
+// otherwise in wall-clock time
+func (c *calendar) elapsedFunc(businessTime bool) func(from, to time.Time) time.Duration {
+	if c == nil || !businessTime {
+		return func(from, to time.Time) time.Duration { return to.Sub(from) }
+	}
+	return c.businessTime
+}
+
+// activeFreeze returns the first freeze window covering the minor at t, or nil.  A minor of -1, as used by streams
+// spanning every minor, is only covered by windows that are not restricted to specific minors.
+func (c *calendar) activeFreeze(minor int, t time.Time) *freezeWindow {
+	if c == nil {
+		return nil
+	}
+	for i := range c.FreezeWindows {
+		window := &c.FreezeWindows[i]
+		if t.Before(window.start) || !t.Before(window.end) {
+			continue
+		}
+		if len(window.minors) > 0 {
+			if _, ok := window.minors[minor]; !ok {
+				continue
+			}
+		}
+		return window
+	}
+	return nil
+}
+
+func (w *freezeWindow) String() string {
+	description := fmt.Sprintf("freeze window %s to %s", w.Start, w.End)
+	if w.Reason != "" {
+		description += fmt.Sprintf(" (%s)", w.Reason)
+	}
+	return description
+}
+
+// applyFreezeWindows suppresses or downgrades the findings whose minor is in a freeze window, and records a note for
+// each stream it changed.  The findings of streams spanning every minor, such as 4-stable, follow the windows of the
+// minors they are about, and a stream is only downgraded when all of its remaining findings are.
+func (rep *report) applyFreezeWindows(cal *calendar, now time.Time) {
+	for _, stream := range rep.sortedStreams() {
+		streamReport := rep.streams[stream]
+		if len(streamReport.unhealthyMessages) == 0 {
+			continue
+		}
+		var windows []*freezeWindow
+		counts := map[*freezeWindow]int{}
+		kept := &releaseReport{}
+		for i, msg := range streamReport.unhealthyMessages {
+			window := cal.activeFreeze(streamReport.unhealthyMinors[i], now)
+			if window != nil {
+				if counts[window] == 0 {
+					windows = append(windows, window)
+				}
+				counts[window]++
+				if window.Action == freezeSuppress {
+					streamReport.healthyMessages = append(streamReport.healthyMessages, "Suppressed during freeze: "+msg)
+					continue
+				}
+			}
+			kept.addUnhealthy(streamReport.unhealthyChecks[i], streamReport.unhealthyMinors[i], msg)
+		}
+
+		downgraded := 0
+		for _, window := range windows {
+			if window.Action == freezeSuppress {
+				rep.freezeNotes = append(rep.freezeNotes, fmt.Sprintf("%d findings for %s were suppressed during the %s", counts[window], stream, window))
+			} else {
+				downgraded += counts[window]
+			}
+		}
+		if len(kept.unhealthyMessages) < len(streamReport.unhealthyMessages) {
+			streamReport.unhealthyMessages, streamReport.unhealthyChecks, streamReport.unhealthyMinors = kept.unhealthyMessages, kept.unhealthyChecks, kept.unhealthyMinors
+			streamReport.unhealthyMentions = nil
+			if len(kept.unhealthyMessages) == 0 {
+				streamReport.changelog = nil
+				streamReport.suppressed = true
+			}
+		}
+		if downgraded > 0 && downgraded == len(kept.unhealthyMessages) {
+			streamReport.severity = severityLow
+			for _, window := range windows {
+				if window.Action != freezeSuppress {
+					rep.freezeNotes = append(rep.freezeNotes, fmt.Sprintf("Findings for %s were downgraded to low severity during the %s", stream, window))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusinessTime(t *testing.T) {
+	utc := func(value string) time.Time {
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatalf("invalid time %q: %v", value, err)
+		}
+		return ts
+	}
+	testCases := []struct {
+		name     string
+		calendar calendar
+		from     time.Time
+		to       time.Time
+		expected time.Duration
+	}{
+		{
+			name:     "within a business day",
+			from:     utc("2026-10-14T08:00:00Z"),
+			to:       utc("2026-10-14T20:00:00Z"),
+			expected: 12 * time.Hour,
+		},
+		{
+			name:     "across business days",
+			from:     utc("2026-10-14T12:00:00Z"),
+			to:       utc("2026-10-16T12:00:00Z"),
+			expected: 48 * time.Hour,
+		},
+		{
+			name:     "weekend is skipped",
+			from:     utc("2026-10-16T12:00:00Z"),
+			to:       utc("2026-10-19T12:00:00Z"),
+			expected: 24 * time.Hour,
+		},
+		{
+			name:     "entirely on a weekend",
+			from:     utc("2026-10-17T01:00:00Z"),
+			to:       utc("2026-10-18T23:00:00Z"),
+			expected: 0,
+		},
+		{
+			name:     "custom weekend",
+			calendar: calendar{Weekends: []string{"Friday", "Saturday"}},
+			from:     utc("2026-10-16T12:00:00Z"),
+			to:       utc("2026-10-19T12:00:00Z"),
+			expected: 36 * time.Hour,
+		},
+		{
+			name:     "holiday is skipped",
+			calendar: calendar{Holidays: []string{"2026-10-15"}},
+			from:     utc("2026-10-14T12:00:00Z"),
+			to:       utc("2026-10-16T12:00:00Z"),
+			expected: 24 * time.Hour,
+		},
+		{
+			name:     "weekend in the calendar's time zone",
+			calendar: calendar{Location: "America/New_York"},
+			// Friday 23:00 to Monday 01:00 in New York, which is Saturday 03:00 to Monday 05:00 in UTC
+			from:     utc("2026-10-17T03:00:00Z"),
+			to:       utc("2026-10-19T05:00:00Z"),
+			expected: 2 * time.Hour,
+		},
+		{
+			name:     "holiday in the calendar's time zone",
+			calendar: calendar{Location: "America/New_York", Holidays: []string{"2026-10-15"}},
+			// the holiday starts at 04:00 in UTC
+			from:     utc("2026-10-15T00:00:00Z"),
+			to:       utc("2026-10-15T12:00:00Z"),
+			expected: 4 * time.Hour,
+		},
+		{
+			name:     "to before from",
+			from:     utc("2026-10-16T12:00:00Z"),
+			to:       utc("2026-10-14T12:00:00Z"),
+			expected: 0,
+		},
+		{
+			name:     "zero from is not walked day by day",
+			to:       utc("2026-10-16T12:00:00Z"),
+			expected: utc("2026-10-16T12:00:00Z").Sub(time.Time{}),
+		},
+		{
+			name:     "zero to",
+			from:     utc("2026-10-16T12:00:00Z"),
+			expected: time.Time{}.Sub(utc("2026-10-16T12:00:00Z")),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cal := tc.calendar
+			if err := cal.complete(); err != nil {
+				t.Fatalf("unexpected error completing the calendar: %v", err)
+			}
+			if elapsed := cal.businessTime(tc.from, tc.to); elapsed != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	changelogPath = "/changelog?from=%s&to=%s&format=json"
+
+	// maximum number of images to list individually in the report summary
+	maxChangelogSummaryImages = 10
+)
+
+// changeLog is the subset of the release controller's json changelog between two payloads that we care about
+type changeLog struct {
+	From          changeLogRelease     `json:"from"`
+	To            changeLogRelease     `json:"to"`
+	Components    []changeLogComponent `json:"components,omitempty"`
+	NewImages     []changeLogImage     `json:"newImages,omitempty"`
+	UpdatedImages []changeLogImage     `json:"updatedImages,omitempty"`
+}
+
+type changeLogRelease struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+type changeLogComponent struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	From    string `json:"from,omitempty"`
+}
+
+type changeLogImage struct {
+	Name    string            `json:"name"`
+	Path    string            `json:"path"`
+	Commits []changeLogCommit `json:"commits"`
+}
+
+type changeLogCommit struct {
+	Subject   string `json:"subject"`
+	PullID    int    `json:"pullID"`
+	PullURL   string `json:"pullURL"`
+	CommitURL string `json:"commitURL"`
+}
+
+// acceptanceChangelog is the set of changes that landed between the last accepted payload of a stream and its
+// newest rejected payload, which is where the change that broke acceptance usually hides.
+type acceptanceChangelog struct {
+	lastAccepted   string
+	firstRejected  string
+	newestRejected string
+	changelog      *changeLog
+}
+
+func getChangelog(releaseAPIUrl, from, to string) (*changeLog, error) {
+	cl := &changeLog{}
+	if err := getJSON(releaseAPIUrl+fmt.Sprintf(changelogPath, url.QueryEscape(from), url.QueryEscape(to)), cl); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
+// getAcceptanceChangelog finds the last accepted payload in the stream and the rejected payloads built after it, and
+// fetches the changelog between the last accepted and the newest rejected payload.  A nil result with no error means
+// the stream has no rejected payloads newer than its last accepted one.
+func getAcceptanceChangelog(releaseAPIUrl, stream string) (*acceptanceChangelog, error) {
+	tags, err := getReleaseStreamTags(releaseAPIUrl, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastAccepted string
+	var lastAcceptedTime time.Time
+	for _, tag := range tags.Tags {
+		if tag.Phase != phaseAccepted {
+			continue
+		}
+		ts, err := getPayloadTimestamp(tag.Name)
+		if err != nil {
+			continue
+		}
+		if ts.After(lastAcceptedTime) {
+			lastAccepted, lastAcceptedTime = tag.Name, ts
+		}
+	}
+	if lastAccepted == "" {
+		return nil, nil
+	}
+
+	result := &acceptanceChangelog{lastAccepted: lastAccepted}
+	var firstRejectedTime, newestRejectedTime time.Time
+	for _, tag := range tags.Tags {
+		if tag.Phase != phaseRejected {
+			continue
+		}
+		ts, err := getPayloadTimestamp(tag.Name)
+		if err != nil || !ts.After(lastAcceptedTime) {
+			continue
+		}
+		if firstRejectedTime.IsZero() || ts.Before(firstRejectedTime) {
+			result.firstRejected, firstRejectedTime = tag.Name, ts
+		}
+		if ts.After(newestRejectedTime) {
+			result.newestRejected, newestRejectedTime = tag.Name, ts
+		}
+	}
+	if result.newestRejected == "" {
+		return nil, nil
+	}
+
+	result.changelog, err = getChangelog(releaseAPIUrl, result.lastAccepted, result.newestRejected)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// images returns the new and updated images in the changelog, ordered by descending number of commits
+func (c *acceptanceChangelog) images() []changeLogImage {
+	images := append([]changeLogImage{}, c.changelog.UpdatedImages...)
+	images = append(images, c.changelog.NewImages...)
+	sort.SliceStable(images, func(i, j int) bool {
+		if len(images[i].Commits) != len(images[j].Commits) {
+			return len(images[i].Commits) > len(images[j].Commits)
+		}
+		return images[i].Name < images[j].Name
+	})
+	return images
+}
+
+// componentChanges describes the changes in component versions, such as Kubernetes or RHCOS
+func (c *acceptanceChangelog) componentChanges() []string {
+	changes := []string{}
+	for _, component := range c.changelog.Components {
+		if component.From == "" || component.From == component.Version {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s %s -> %s", component.Name, component.From, component.Version))
+	}
+	return changes
+}
+
+// summary is a single line describing the changes by image, suitable for inclusion in the report
+func (c *acceptanceChangelog) summary() string {
+	images := c.images()
+	commits := 0
+	counts := []string{}
+	for i, image := range images {
+		commits += len(image.Commits)
+		if i < maxChangelogSummaryImages {
+			counts = append(counts, fmt.Sprintf("%s (%d)", image.Name, len(image.Commits)))
+		}
+	}
+	if len(images) > maxChangelogSummaryImages {
+		counts = append(counts, fmt.Sprintf("and %d more", len(images)-maxChangelogSummaryImages))
+	}
+
+	summary := fmt.Sprintf("Changes from last accepted %s to newest rejected %s (first rejected was %s): %d commits in %d images", c.lastAccepted, c.newestRejected, c.firstRejected, commits, len(images))
+	if len(counts) > 0 {
+		summary += ": " + strings.Join(counts, ", ")
+	}
+	if components := c.componentChanges(); len(components) > 0 {
+		summary += "; " + strings.Join(components, ", ")
+	}
+	return summary
+}
+
+// details lists every change in the changelog, grouped by image
+func (c *acceptanceChangelog) details() string {
+	output := fmt.Sprintf("Changes from %s (last accepted) to %s (newest rejected)\n", c.lastAccepted, c.newestRejected)
+	if components := c.componentChanges(); len(components) > 0 {
+		output += fmt.Sprintf("Component versions: %s\n", strings.Join(components, ", "))
+	}
+	for _, image := range c.images() {
+		output += fmt.Sprintf("%s:\n", image.Name)
+		for _, commit := range image.Commits {
+			link := commit.PullURL
+			if link == "" {
+				link = commit.CommitURL
+			}
+			output += fmt.Sprintf("  * %s %s\n", commit.Subject, link)
+		}
+	}
+	return output
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// upgradeFromAny accepts an upgrade from any payload of the source minor
+	upgradeFromAny = "any"
+	// upgradeFromLatestGA only accepts an upgrade from the newest generally available z release of the source minor
+	upgradeFromLatestGA = "latest-ga"
+
+	// cadencePhaseSupported applies to minors that have shipped a generally available release
+	cadencePhaseSupported = "supported"
+	// cadencePhaseDevelopment applies to minors that have only shipped engineering or release candidates, if any
+	cadencePhaseDevelopment = "development"
+
+	// phasePreGA applies to minors that have not shipped yet but are past their freeze date, so they are held to the
+	// normal rules while still being labeled as pre-GA
+	phasePreGA = "pre-GA"
+
+	// the life-cycle phases of supported minors, as named by the product life-cycle data
+	phaseFullSupport        = "Full Support"
+	phaseMaintenanceSupport = "Maintenance Support"
+	phaseEUS                = "Extended Update Support"
+	phaseEUSTerm2           = "Extended Update Support Term 2"
+
+	severityHigh = "high"
+	severityLow  = "low"
+)
+
+var (
+	// the upgrade paths required when no configuration is provided: any patch level and any minor level upgrade
+	defaultUpgradePaths = []upgradePath{
+		{Name: "patch level", MinorOffset: 0, From: upgradeFromAny},
+		{Name: "minor level", MinorOffset: 1, From: upgradeFromAny},
+	}
+
+	// how long each lifecycle phase may go without shipping a release when no configuration is provided
+	defaultReleaseCadence = map[string]time.Duration{
+		cadencePhaseSupported:   21 * 24 * time.Hour,
+		cadencePhaseDevelopment: 21 * 24 * time.Hour,
+	}
+
+	// the phases that may key the release cadence and the phase policies
+	knownPhases = []string{cadencePhaseSupported, cadencePhaseDevelopment, phasePreGA, phaseFullSupport, phaseMaintenanceSupport, phaseEUS, phaseEUSTerm2}
+
+	// the policies used for phases that are not configured.  Minor upgrades into a release in early development are
+	// expected to be broken, so they are not required.
+	defaultPhasePolicies = map[string]phasePolicy{
+		cadencePhaseDevelopment: {Severity: severityHigh, SkipMinorUpgrades: &skipMinorUpgrades},
+	}
+	skipMinorUpgrades = true
+)
+
+// config is the optional configuration file of the watcher, provided with --config
+type config struct {
+	// UpgradePaths are the upgrade paths every matching stream must have recently succeeded on
+	UpgradePaths []upgradePath `json:"upgradePaths,omitempty"`
+	// ReleaseCadence is how long each lifecycle phase may go without shipping a release on the stable and
+	// dev-preview streams, keyed by phase
+	ReleaseCadence map[string]duration `json:"releaseCadence,omitempty"`
+	// Phases holds the policy for streams whose minor is in a life-cycle phase, keyed by the phase name used in the
+	// product life-cycle data (e.g. "Full Support", "Maintenance Support" or "Extended Update Support")
+	Phases map[string]phasePolicy `json:"phases,omitempty"`
+	// NormalRulesFrom is, per pre-GA minor (e.g. "4.17"), the date (e.g. "2026-11-01") of its feature or code freeze.
+	// Until then its streams use the "development" phase policy, afterwards they are held to the normal rules.
+	NormalRulesFrom map[string]string `json:"normalRulesFrom,omitempty"`
+	// Calendar declares the weekends, holidays and release freezes of the streams
+	Calendar *calendar `json:"calendar,omitempty"`
+	// Owners route unhealthy findings to the Slack user groups responsible for them, which the bot tags
+	Owners []owner `json:"owners,omitempty"`
+	// QuietHours is the time of day during which the bot does not tag anyone
+	QuietHours *quietHours `json:"quietHours,omitempty"`
+	// Escalations are the levels to which the bot escalates streams that stay unhealthy, until they are acknowledged
+	Escalations []escalation `json:"escalations,omitempty"`
+
+	normalRulesFrom map[int]time.Time
+}
+
+// phasePolicy overrides the staleness limits and severity of the findings for streams in a life-cycle phase
+type phasePolicy struct {
+	AcceptedStalenessLimit *duration `json:"acceptedStalenessLimit,omitempty"`
+	BuiltStalenessLimit    *duration `json:"builtStalenessLimit,omitempty"`
+	UpgradeStalenessLimit  *duration `json:"upgradeStalenessLimit,omitempty"`
+	// Severity is either "high" (default) or "low"
+	Severity string `json:"severity,omitempty"`
+	// SkipUpgradePaths names the upgrade paths that are not required in this phase
+	SkipUpgradePaths []string `json:"skipUpgradePaths,omitempty"`
+	// SkipMinorUpgrades exempts the phase from every upgrade path from an older minor (a positive minor offset).  When
+	// unset, the built-in policy of the phase decides.
+	SkipMinorUpgrades *bool `json:"skipMinorUpgrades,omitempty"`
+}
+
+// upgradePath declares an upgrade that a release stream is required to have recently succeeded on
+type upgradePath struct {
+	// Name identifies the path in the report, e.g. "minor level" or "EUS-to-EUS"
+	Name string `json:"name"`
+	// Streams is a regular expression selecting the streams the path applies to, all streams when empty
+	Streams string `json:"streams,omitempty"`
+	// MinorOffset is how many minors older the source of the upgrade is than the stream, 0 for patch upgrades
+	MinorOffset int `json:"minorOffset"`
+	// From is either "any" (default) or "latest-ga"
+	From string `json:"from,omitempty"`
+	// EvenMinorsOnly restricts the path to streams of even minors, as used by EUS releases
+	EvenMinorsOnly bool `json:"evenMinorsOnly,omitempty"`
+	// Phases restricts the path to streams whose minor is in one of these life-cycle phases
+	Phases []string `json:"phases,omitempty"`
+	// Freshness overrides the upgrade staleness limit for this path
+	Freshness *duration `json:"freshness,omitempty"`
+
+	streamsRegex *regexp.Regexp
+}
+
+// duration is a time.Duration that is read from json as a string such as "72h"
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations must be strings such as \"72h\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// loadConfig reads the configuration file at path, or returns the default configuration if path is empty
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file %s: %w", path, err)
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("error decoding config file %s: %w", path, err)
+		}
+	}
+	if err := cfg.complete(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// complete fills in defaults and validates the configuration
+func (c *config) complete() error {
+	if len(c.UpgradePaths) == 0 {
+		c.UpgradePaths = append([]upgradePath{}, defaultUpgradePaths...)
+	}
+	if c.Calendar != nil {
+		if err := c.Calendar.complete(); err != nil {
+			return err
+		}
+	}
+	for i := range c.Owners {
+		if err := c.Owners[i].complete(i); err != nil {
+			return err
+		}
+	}
+	if c.QuietHours != nil {
+		if err := c.QuietHours.complete(); err != nil {
+			return err
+		}
+	}
+	for i, level := range c.Escalations {
+		if level.After.Duration <= 0 {
+			return fmt.Errorf("escalation %d must have a positive \"after\" duration", i)
+		}
+		if len(level.Groups) == 0 && len(level.Channels) == 0 {
+			return fmt.Errorf("escalation %d has neither groups nor channels to escalate to", i)
+		}
+	}
+	sort.SliceStable(c.Escalations, func(i, j int) bool { return c.Escalations[i].After.Duration < c.Escalations[j].After.Duration })
+	c.normalRulesFrom = make(map[int]time.Time, len(c.NormalRulesFrom))
+	for version, date := range c.NormalRulesFrom {
+		m := minorOnlyRegex.FindStringSubmatch(version)
+		if m == nil {
+			return fmt.Errorf("normal rules date for %q must be keyed by a minor such as \"4.17\"", version)
+		}
+		minor, _ := strconv.Atoi(m[1])
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return fmt.Errorf("normal rules date for %s must be formatted as YYYY-MM-DD: %w", version, err)
+		}
+		c.normalRulesFrom[minor] = t
+	}
+	for phase := range c.ReleaseCadence {
+		if !contains(knownPhases, phase) {
+			return fmt.Errorf("release cadence has unknown lifecycle phase %q, must be one of %q", phase, knownPhases)
+		}
+	}
+	for phase, policy := range c.Phases {
+		if !contains(knownPhases, phase) {
+			return fmt.Errorf("phases has unknown lifecycle phase %q, must be one of %q", phase, knownPhases)
+		}
+		switch policy.Severity {
+		case "":
+			policy.Severity = severityHigh
+			c.Phases[phase] = policy
+		case severityHigh, severityLow:
+		default:
+			return fmt.Errorf("phase %q has unknown severity %q, must be %q or %q", phase, policy.Severity, severityHigh, severityLow)
+		}
+	}
+	for i := range c.UpgradePaths {
+		path := &c.UpgradePaths[i]
+		if path.Name == "" {
+			return fmt.Errorf("upgrade path %d has no name", i)
+		}
+		if path.MinorOffset < 0 {
+			return fmt.Errorf("upgrade path %q has a negative minor offset", path.Name)
+		}
+		switch path.From {
+		case "":
+			path.From = upgradeFromAny
+		case upgradeFromAny, upgradeFromLatestGA:
+		default:
+			return fmt.Errorf("upgrade path %q has unknown source %q, must be %q or %q", path.Name, path.From, upgradeFromAny, upgradeFromLatestGA)
+		}
+		if path.Streams != "" {
+			re, err := regexp.Compile(path.Streams)
+			if err != nil {
+				return fmt.Errorf("upgrade path %q has an invalid streams expression: %w", path.Name, err)
+			}
+			path.streamsRegex = re
+		}
+	}
+	return nil
+}
+
+// cadenceThreshold is how long a minor may go without shipping a release.  The threshold configured for the first of
+// the given phases wins, so a life-cycle phase such as "Full Support" can be passed ahead of "supported".
+func (c *config) cadenceThreshold(phases ...string) time.Duration {
+	for _, phase := range phases {
+		if d, ok := c.ReleaseCadence[phase]; ok {
+			return d.Duration
+		}
+	}
+	for _, phase := range phases {
+		if d, ok := defaultReleaseCadence[phase]; ok {
+			return d
+		}
+	}
+	return 0
+}
+
+// phasePolicy returns the policy for a life-cycle phase, falling back to the built-in policy for the phase and then
+// to an empty policy.  A configured policy that does not set SkipMinorUpgrades keeps the built-in setting.
+func (c *config) phasePolicy(phase string) phasePolicy {
+	if policy, ok := c.Phases[phase]; ok {
+		if policy.SkipMinorUpgrades == nil {
+			policy.SkipMinorUpgrades = defaultPhasePolicies[phase].SkipMinorUpgrades
+		}
+		return policy
+	}
+	if policy, ok := defaultPhasePolicies[phase]; ok {
+		return policy
+	}
+	return phasePolicy{Severity: severityHigh}
+}
+
+// preGAPhase returns the phase of a minor that has not shipped yet: "development" until its freeze date, "pre-GA"
+// afterwards
+func (c *config) preGAPhase(minor int, now time.Time) string {
+	if from, ok := c.normalRulesFrom[minor]; ok && !now.Before(from) {
+		return phasePreGA
+	}
+	return cadencePhaseDevelopment
+}
+
+// skips reports whether the policy exempts streams from the upgrade path
+func (p phasePolicy) skips(path *upgradePath) bool {
+	if p.SkipMinorUpgrades != nil && *p.SkipMinorUpgrades && path.MinorOffset > 0 {
+		return true
+	}
+	for _, skipped := range p.SkipUpgradePaths {
+		if skipped == path.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// limit returns the overridden limit, or the default if the policy does not override it
+func (p phasePolicy) limit(override *duration, defaultLimit time.Duration) time.Duration {
+	if override != nil {
+		return override.Duration
+	}
+	return defaultLimit
+}
+
+// appliesTo reports whether the path is required for the given stream of the given minor in the given life-cycle phase
+func (p *upgradePath) appliesTo(stream string, minor int, phase string) bool {
+	if p.EvenMinorsOnly && minor%2 != 0 {
+		return false
+	}
+	if len(p.Phases) > 0 {
+		matched := false
+		for _, allowed := range p.Phases {
+			if allowed == phase {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if minor-p.MinorOffset < 0 {
+		return false
+	}
+	return p.streamsRegex == nil || p.streamsRegex.MatchString(stream)
+}
+
+// freshness is how recently the upgrade must have succeeded
+func (p *upgradePath) freshness(defaultLimit time.Duration) time.Duration {
+	if p.Freshness != nil {
+		return p.Freshness.Duration
+	}
+	return defaultLimit
+}
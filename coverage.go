@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// how many minors older than the target stream a source version may be to appear in the matrix
+	coverageMinorSpan = 2
+)
+
+var (
+	// a named release version such as 4.15.23, 4.16.0-ec.3, 4.16.0-rc.1 or 4.15.23-multi
+	namedVersionRegex = regexp.MustCompile(`^4\.([0-9]+)\.([0-9]+)(?:-(ec|rc)\.([0-9]+))?` + releaseArchSuffix + `$`)
+)
+
+// coverageMatrix holds, for every target stream and source version, the age of the most recent successful upgrade
+type coverageMatrix struct {
+	releaseAPIUrl  string
+	stalenessLimit time.Duration
+	// how far back upgrades were looked for
+	window time.Duration
+	// target streams, from the newest to the oldest minor
+	streams      []string
+	streamMinors map[string]int
+	// source versions, from the newest to the oldest
+	sources      []string
+	sourceMinors map[string]int
+	// source -> target stream -> age of the most recent successful upgrade
+	cells map[string]map[string]time.Duration
+}
+
+// coverageSource returns the matrix row for an upgrade source.  Named releases get their own row, while ci and
+// nightly payloads are collapsed into a single row per minor.
+func coverageSource(from string) (string, int, bool) {
+	if m := namedVersionRegex.FindStringSubmatch(from); m != nil {
+		minor, _ := strconv.Atoi(m[1])
+		return from, minor, true
+	}
+	if m := extractMinorRegex.FindStringSubmatch(from); m != nil {
+		minor, _ := strconv.Atoi(m[1])
+		return fmt.Sprintf("4.%d payloads", minor), minor, true
+	}
+	return "", 0, false
+}
+
+// namedVersionLess orders named release versions, with GA releases after release candidates after engineering candidates
+func namedVersionLess(a, b string) bool {
+	am := namedVersionRegex.FindStringSubmatch(a)
+	bm := namedVersionRegex.FindStringSubmatch(b)
+	if am == nil || bm == nil {
+		// anything that is not a named version, such as a collapsed payload row, sorts after all named versions
+		return am != nil && bm == nil
+	}
+	for _, i := range []int{1, 2} {
+		av, _ := strconv.Atoi(am[i])
+		bv, _ := strconv.Atoi(bm[i])
+		if av != bv {
+			return av < bv
+		}
+	}
+	rank := map[string]int{"ec": 0, "rc": 1, "": 2}
+	if rank[am[3]] != rank[bm[3]] {
+		return rank[am[3]] < rank[bm[3]]
+	}
+	av, _ := strconv.Atoi(am[4])
+	bv, _ := strconv.Atoi(bm[4])
+	return av < bv
+}
+
+func generateCoverageMatrix(o *options) (*coverageMatrix, error) {
+	supported, err := resolveMinorRange(o, nil)
+	if err != nil {
+		return nil, err
+	}
+	oldestMinor, newestMinor := supported.oldest, supported.newest
+	releaseAPIUrl, found := releaseAPIUrls[o.arch]
+	if !found {
+		return nil, fmt.Errorf("unknown architecture: %s", o.arch)
+	}
+	allReleases, err := getReleaseStream(releaseAPIUrl + allReleasePath)
+	if err != nil {
+		return nil, err
+	}
+	stableGraph, attemptedGraph, err := getUpgradeGraphs(releaseAPIUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	matrix := &coverageMatrix{
+		releaseAPIUrl:  releaseAPIUrl,
+		stalenessLimit: o.upgradeStalenessLimit,
+		window:         o.window,
+		streamMinors:   make(map[string]int),
+		sourceMinors:   make(map[string]int),
+		cells:          make(map[string]map[string]time.Duration),
+	}
+	now := time.Now()
+	for stream, payloads := range allReleases {
+		matches := zReleaseRegex.FindStringSubmatch(stream)
+		if matches == nil {
+			continue
+		}
+		minor, _ := strconv.Atoi(matches[1])
+		if minor < oldestMinor || minor > newestMinor {
+			continue
+		}
+		matrix.streams = append(matrix.streams, stream)
+		matrix.streamMinors[stream] = minor
+
+		for _, payload := range payloads {
+			// only the payloads within the window have their upgrade results fetched, which also bounds the ages the
+			// matrix can show
+			ts, err := getPayloadTimestamp(payload)
+			if err != nil {
+				klog.Error(err.Error())
+				continue
+			}
+			if now.Sub(ts) > o.window {
+				continue
+			}
+			for _, result := range getUpgradeResults(releaseAPIUrl, stream, payload, stableGraph, attemptedGraph) {
+				if !result.succeeded {
+					continue
+				}
+				source, sourceMinor, ok := coverageSource(result.from)
+				if !ok || sourceMinor > minor || sourceMinor < minor-coverageMinorSpan {
+					continue
+				}
+				if _, ok := matrix.cells[source]; !ok {
+					matrix.cells[source] = make(map[string]time.Duration)
+					matrix.sourceMinors[source] = sourceMinor
+				}
+				age := now.Sub(result.ran)
+				if current, ok := matrix.cells[source][stream]; !ok || age < current {
+					matrix.cells[source][stream] = age
+				}
+			}
+		}
+	}
+
+	sort.Slice(matrix.streams, func(i, j int) bool {
+		if matrix.streamMinors[matrix.streams[i]] != matrix.streamMinors[matrix.streams[j]] {
+			return matrix.streamMinors[matrix.streams[i]] > matrix.streamMinors[matrix.streams[j]]
+		}
+		return matrix.streams[i] < matrix.streams[j]
+	})
+
+	// keep the collapsed payload row and the newest named versions of each minor
+	byMinor := make(map[int][]string)
+	for source, minor := range matrix.sourceMinors {
+		byMinor[minor] = append(byMinor[minor], source)
+	}
+	minors := []int{}
+	for minor := range byMinor {
+		minors = append(minors, minor)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(minors)))
+	for _, minor := range minors {
+		sources := byMinor[minor]
+		sort.Slice(sources, func(i, j int) bool { return namedVersionLess(sources[j], sources[i]) })
+		named := 0
+		for _, source := range sources {
+			if namedVersionRegex.MatchString(source) {
+				if o.sourcesPerMinor > 0 && named >= o.sourcesPerMinor {
+					continue
+				}
+				named++
+			}
+			matrix.sources = append(matrix.sources, source)
+		}
+	}
+	return matrix, nil
+}
+
+func (m *coverageMatrix) String() string {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "SOURCE \\ TARGET")
+	for _, stream := range m.streams {
+		fmt.Fprintf(w, "\t%s", stream)
+	}
+	fmt.Fprintln(w)
+	for _, source := range m.sources {
+		fmt.Fprint(w, source)
+		sourceMinor := m.sourceMinors[source]
+		for _, stream := range m.streams {
+			minor := m.streamMinors[stream]
+			age, ok := m.cells[source][stream]
+			switch {
+			case sourceMinor > minor || sourceMinor < minor-coverageMinorSpan:
+				fmt.Fprint(w, "\t")
+			case !ok:
+				fmt.Fprint(w, "\t-")
+			case age > m.stalenessLimit:
+				fmt.Fprintf(w, "\t%.1fd*", age.Hours()/24)
+			default:
+				fmt.Fprintf(w, "\t%.1fd", age.Hours()/24)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	_ = w.Flush()
+	fmt.Fprintf(buf, "\nCells show the days since the most recent successful upgrade, '-' when none is recorded within %.1f days and '*' when older than %.1f days\n", m.window.Hours()/24, m.stalenessLimit.Hours()/24)
+	fmt.Fprintf(buf, "Release pages: %s\n", m.releaseAPIUrl)
+	return buf.String()
+}
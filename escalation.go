@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the prefix of the action id of the buttons acknowledging a stream's findings, which carry the arguments of the
+	// ack command as value
+	ackActionPrefix = "acknowledge-"
+)
+
+// escalation is a level of the escalation policy: findings that stay unhealthy for After are escalated to its groups,
+// which are tagged in the report, and its channels, which are sent a notice when the level is reached
+type escalation struct {
+	After    duration `json:"after"`
+	Groups   []string `json:"groups,omitempty"`
+	Channels []string `json:"channels,omitempty"`
+}
+
+// findingState is what the bot remembers about the findings of an unhealthy stream between reports
+type findingState struct {
+	// FirstSeen is when a report first found the stream unhealthy
+	FirstSeen time.Time `json:"firstSeen"`
+	// Checks are the checks the stream fails.  Acknowledgements only hold while these stay the same.
+	Checks []string `json:"checks"`
+	// Level is how many escalation levels have been notified
+	Level   int        `json:"level"`
+	AckedBy string     `json:"ackedBy,omitempty"`
+	AckedAt *time.Time `json:"ackedAt,omitempty"`
+}
+
+// escalationNotice is the message sent to a channel when a stream reaches one of its escalation levels
+type escalationNotice struct {
+	channel string
+	text    string
+	rich    *slackMessage
+}
+
+// escalationState tracks the unhealthy streams, keyed by stream, and is saved to path after every change so
+// acknowledgements survive restarts of the bot
+type escalationState struct {
+	Findings map[string]*findingState `json:"findings"`
+
+	path string
+	lock sync.Mutex
+}
+
+// loadEscalationState reads the state saved at path, starting empty when there is none yet.  An empty path keeps the
+// state in memory only.
+func loadEscalationState(path string) (*escalationState, error) {
+	state := &escalationState{Findings: map[string]*findingState{}, path: path}
+	if path == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading escalation state %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("error decoding escalation state %s: %w", path, err)
+	}
+	if state.Findings == nil {
+		state.Findings = map[string]*findingState{}
+	}
+	return state, nil
+}
+
+// save writes the state to its file, if it has one.  The caller must hold the lock.
+func (s *escalationState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("error encoding escalation state: %w", err)
+	}
+	if err := writeFileAtomically(s.path, data); err != nil {
+		return fmt.Errorf("error writing escalation state %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// update records the findings of a report and escalates the streams that have been unhealthy past the levels of the
+// policy, unless they are acknowledged.  Streams the report found healthy are forgotten, while the streams whose
+// findings a freeze window suppressed are left as they were.  A stream whose failing checks changed loses its
+// acknowledgement.  When notify is false, during quiet hours, nobody is tagged and no level is marked as notified, so
+// the escalation happens after the quiet hours instead.  It returns the notices to send for the levels reached since
+// the previous report, and the mentions of every group the report escalates to.
+func (s *escalationState) update(rep *report, levels []escalation, now time.Time, notify bool, mention func(group string) string) ([]escalationNotice, []string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	notices := []escalationNotice{}
+	tagged := map[string]struct{}{}
+	for _, stream := range rep.sortedStreams() {
+		streamReport := rep.streams[stream]
+		if streamReport.suppressed {
+			continue
+		}
+		if len(streamReport.unhealthyMessages) == 0 {
+			delete(s.Findings, stream)
+			continue
+		}
+		checks := distinctChecks(streamReport.unhealthyChecks)
+		state, ok := s.Findings[stream]
+		if !ok {
+			state = &findingState{FirstSeen: now}
+			s.Findings[stream] = state
+		} else if strings.Join(state.Checks, ",") != strings.Join(checks, ",") {
+			state.AckedBy, state.AckedAt = "", nil
+		}
+		state.Checks = checks
+
+		age := now.Sub(state.FirstSeen)
+		if state.AckedBy != "" {
+			streamReport.escalation = fmt.Sprintf("Acknowledged by <@%s>, escalation is paused until the findings change", state.AckedBy)
+			continue
+		}
+		streamReport.acknowledgeable = len(levels) > 0
+		reached := 0
+		for reached < len(levels) && age >= levels[reached].After.Duration {
+			reached++
+		}
+		if reached == 0 {
+			continue
+		}
+		if !notify {
+			streamReport.escalation = fmt.Sprintf("Unhealthy for %.1f days", age.Hours()/24)
+			continue
+		}
+
+		mentions := []string{}
+		for _, level := range levels[:reached] {
+			for _, group := range level.Groups {
+				if m := mention(group); !contains(mentions, m) {
+					mentions = append(mentions, m)
+					tagged[m] = struct{}{}
+				}
+			}
+		}
+		streamReport.escalation = fmt.Sprintf("Unhealthy for %.1f days, escalated", age.Hours()/24)
+		if len(mentions) > 0 {
+			streamReport.escalation += " to " + strings.Join(mentions, " ")
+		}
+		for ; state.Level < reached; state.Level++ {
+			for _, channel := range levels[state.Level].Channels {
+				notices = append(notices, rep.escalationNotice(stream, channel, age, mentions))
+			}
+		}
+	}
+
+	all := make([]string, 0, len(tagged))
+	for m := range tagged {
+		all = append(all, m)
+	}
+	sort.Strings(all)
+	return notices, all, s.save()
+}
+
+// acknowledge pauses the escalation of a stream until its findings change, returning false if the stream has no
+// unhealthy findings to acknowledge
+func (s *escalationState) acknowledge(stream, user string, now time.Time) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state, ok := s.Findings[stream]
+	if !ok {
+		return false, nil
+	}
+	state.AckedBy, state.AckedAt = user, &now
+	return true, s.save()
+}
+
+// String lists the unhealthy streams the bot knows about and whether they are acknowledged
+func (s *escalationState) String() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	streams := make([]string, 0, len(s.Findings))
+	for stream := range s.Findings {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	output := ""
+	for _, stream := range streams {
+		state := s.Findings[stream]
+		output += fmt.Sprintf("`%s` failing %s since %s", stream, strings.Join(state.Checks, ", "), state.FirstSeen.UTC().Format(time.RFC822))
+		if state.AckedBy != "" {
+			output += fmt.Sprintf(", acknowledged by <@%s>", state.AckedBy)
+		}
+		output += "\n"
+	}
+	return output
+}
+
+func distinctChecks(checks []string) []string {
+	distinct := []string{}
+	for _, check := range checks {
+		if !contains(distinct, check) {
+			distinct = append(distinct, check)
+		}
+	}
+	sort.Strings(distinct)
+	return distinct
+}
+
+// escalationNotice renders the notice of a stream reaching an escalation level, with a button acknowledging it
+func (rep *report) escalationNotice(stream, channel string, age time.Duration, mentions []string) escalationNotice {
+	text := fmt.Sprintf("`%s` has been unhealthy for %.1f days", stream, age.Hours()/24)
+	if len(mentions) > 0 {
+		text += ", " + strings.Join(mentions, " ")
+	}
+	text += ":\n"
+	for _, m := range rep.streams[stream].unhealthyMessages {
+		text += "• " + m + "\n"
+	}
+	section := sectionBlock(text)
+	section.Accessory = ackButton(stream, rep.arch)
+	return escalationNotice{
+		channel: channel,
+		text:    text,
+		rich:    &slackMessage{Blocks: []slackBlock{section, contextBlock(fmt.Sprintf("<%s/#%s|Release page>", rep.releaseAPIUrl, stream))}},
+	}
+}
+
+func ackButton(stream, arch string) *slackButton {
+	return &slackButton{Type: "button", Text: slackText{Type: "plain_text", Text: "Acknowledge"}, ActionID: ackActionPrefix + stream, Value: fmt.Sprintf("%s arch=%s", stream, arch), Style: "primary"}
+}
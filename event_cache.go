@@ -0,0 +1,41 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// eventCache remembers the ids of the events seen recently, so the retries Slack sends for an event are only acted on
+// once.  Entries expire after the TTL, which only needs to outlast Slack's retries, so the cache does not grow forever.
+type eventCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]time.Time
+}
+
+func newEventCache(ttl time.Duration) *eventCache {
+	return &eventCache{ttl: ttl, entries: make(map[string]time.Time)}
+}
+
+// add records the event, returning false if it was already seen within the TTL.  Expired entries are dropped.
+func (c *eventCache) add(id string, now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for seen, at := range c.entries {
+		if now.Sub(at) > c.ttl {
+			delete(c.entries, seen)
+		}
+	}
+	if _, found := c.entries[id]; found {
+		return false
+	}
+	c.entries[id] = now
+	return true
+}
+
+// remove forgets the event, so it is acted on when it is seen again
+func (c *eventCache) remove(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, id)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	graphFormatDOT     = "dot"
+	graphFormatMermaid = "mermaid"
+	graphFormatJSON    = "json"
+)
+
+var (
+	// the stream a ci or nightly payload belongs to, e.g. 4.16.0-0.nightly-arm64 in 4.16.0-0.nightly-arm64-2024-05-01-123456
+	payloadStreamRegex = regexp.MustCompile(`^(.*)-[0-9]{4}-[0-9]{2}-[0-9]{2}-[0-9]{6}$`)
+)
+
+// exportedGraph is the selected portion of an upgrade graph, ready to be rendered
+type exportedGraph struct {
+	Channel string         `json:"channel"`
+	Nodes   []exportedNode `json:"nodes"`
+	Edges   []exportedEdge `json:"edges"`
+}
+
+type exportedNode struct {
+	Version string `json:"version"`
+	Payload string `json:"payload,omitempty"`
+	// NoInboundEdges is set for payloads in the selected range that nothing upgrades into
+	NoInboundEdges bool `json:"noInboundEdges,omitempty"`
+}
+
+type exportedEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Age is how long ago the upgrade most recently succeeded, when known
+	Age *duration `json:"age,omitempty"`
+	// Stale is set when the upgrade most recently succeeded longer ago than the upgrade staleness limit
+	Stale bool `json:"stale,omitempty"`
+}
+
+// payloadStream returns the release stream a ci or nightly payload belongs to
+func payloadStream(payload string) (string, bool) {
+	m := payloadStreamRegex.FindStringSubmatch(payload)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// releaseStream returns the release stream a graph node belongs to: the ci or nightly stream of a payload, or the
+// stable or dev-preview stream of a named release on the architecture
+func releaseStream(version, arch string) (string, bool) {
+	if stream, ok := payloadStream(version); ok {
+		return stream, true
+	}
+	m := namedVersionRegex.FindStringSubmatch(version)
+	if m == nil {
+		return "", false
+	}
+	if m[3] != "" {
+		return siblingStream(devPreviewStream, "amd64", arch), true
+	}
+	return siblingStream(stableStream, "amd64", arch), true
+}
+
+// generateGraphExport selects the nodes of the graph within the minor range, along with every edge into them.  When
+// o.highlightStale is set, the upgrade results of each target payload are fetched to date its edges.
+func generateGraphExport(o *options) (*exportedGraph, error) {
+	supported, err := resolveMinorRange(o, nil)
+	if err != nil {
+		return nil, err
+	}
+	oldestMinor, newestMinor := supported.oldest, supported.newest
+	releaseAPIUrl, found := releaseAPIUrls[o.arch]
+	if !found {
+		return nil, fmt.Errorf("unknown architecture: %s", o.arch)
+	}
+	graph, err := getGraph(releaseAPIUrl, o.channel)
+	if err != nil {
+		return nil, err
+	}
+
+	inRange := func(version string) bool {
+		m := extractMinorRegex.FindStringSubmatch(version)
+		if m == nil {
+			return false
+		}
+		minor, _ := strconv.Atoi(m[1])
+		return minor >= oldestMinor && minor <= newestMinor
+	}
+
+	export := &exportedGraph{Channel: o.channel}
+	included := make(map[int]bool)
+	inbound := make(map[int]int)
+	graphMap := GraphMap{}
+	for _, edge := range graph.Edges {
+		from, to := edge[0], edge[1]
+		if from >= len(graph.Nodes) || to >= len(graph.Nodes) || !inRange(graph.Nodes[to].Version) {
+			continue
+		}
+		included[from], included[to] = true, true
+		inbound[to]++
+		graphMap[graph.Nodes[to].Version] = append(graphMap[graph.Nodes[to].Version], graph.Nodes[from].Version)
+	}
+	for i, node := range graph.Nodes {
+		if inRange(node.Version) {
+			included[i] = true
+		}
+	}
+
+	indexes := []int{}
+	for i := range included {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return graph.Nodes[indexes[i]].Version < graph.Nodes[indexes[j]].Version })
+	for _, i := range indexes {
+		export.Nodes = append(export.Nodes, exportedNode{
+			Version:        graph.Nodes[i].Version,
+			Payload:        graph.Nodes[i].Payload,
+			NoInboundEdges: inRange(graph.Nodes[i].Version) && inbound[i] == 0,
+		})
+	}
+
+	now := time.Now()
+	// upgrade results of each target payload, so they are only fetched once no matter how many edges lead into it
+	results := make(map[string][]upgradeResult)
+	for _, edge := range graph.Edges {
+		from, to := edge[0], edge[1]
+		if from >= len(graph.Nodes) || to >= len(graph.Nodes) || !inRange(graph.Nodes[to].Version) {
+			continue
+		}
+		exported := exportedEdge{From: graph.Nodes[from].Version, To: graph.Nodes[to].Version}
+		if o.highlightStale {
+			if stream, ok := releaseStream(exported.To, o.arch); ok {
+				if _, ok := results[exported.To]; !ok {
+					results[exported.To] = getUpgradeResults(releaseAPIUrl, stream, exported.To, graphMap, nil)
+				}
+				var newest *time.Time
+				for _, result := range results[exported.To] {
+					if result.from == exported.From && result.succeeded && (newest == nil || result.ran.After(*newest)) {
+						ran := result.ran
+						newest = &ran
+					}
+				}
+				if newest != nil {
+					exported.Age = &duration{now.Sub(*newest)}
+					exported.Stale = exported.Age.Duration > o.upgradeStalenessLimit
+				}
+			}
+		}
+		export.Edges = append(export.Edges, exported)
+	}
+	return export, nil
+}
+
+func (g *exportedGraph) render(format string) (string, error) {
+	switch format {
+	case graphFormatDOT:
+		return g.dot(), nil
+	case graphFormatMermaid:
+		return g.mermaid(), nil
+	case graphFormatJSON:
+		out, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	default:
+		return "", fmt.Errorf("unknown graph format %q, must be one of %s, %s or %s", format, graphFormatDOT, graphFormatMermaid, graphFormatJSON)
+	}
+}
+
+func (g *exportedGraph) dot() string {
+	output := fmt.Sprintf("digraph %q {\n  rankdir=LR;\n  node [shape=box];\n", "upgrades-"+g.Channel)
+	for _, node := range g.Nodes {
+		if node.NoInboundEdges {
+			output += fmt.Sprintf("  %q [color=red, style=bold];\n", node.Version)
+		} else {
+			output += fmt.Sprintf("  %q;\n", node.Version)
+		}
+	}
+	for _, edge := range g.Edges {
+		attrs := []string{}
+		if edge.Age != nil {
+			attrs = append(attrs, fmt.Sprintf("label=\"%.1fd\"", edge.Age.Hours()/24))
+		}
+		if edge.Stale {
+			attrs = append(attrs, "color=red", "style=dashed")
+		}
+		if len(attrs) > 0 {
+			output += fmt.Sprintf("  %q -> %q [%s];\n", edge.From, edge.To, strings.Join(attrs, ", "))
+		} else {
+			output += fmt.Sprintf("  %q -> %q;\n", edge.From, edge.To)
+		}
+	}
+	output += "}\n"
+	return output
+}
+
+func (g *exportedGraph) mermaid() string {
+	output := "graph LR\n"
+	ids := make(map[string]string, len(g.Nodes))
+	orphans := []string{}
+	for i, node := range g.Nodes {
+		ids[node.Version] = fmt.Sprintf("n%d", i)
+		output += fmt.Sprintf("  %s[\"%s\"]\n", ids[node.Version], node.Version)
+		if node.NoInboundEdges {
+			orphans = append(orphans, ids[node.Version])
+		}
+	}
+	stale := []string{}
+	for i, edge := range g.Edges {
+		if edge.Age != nil {
+			output += fmt.Sprintf("  %s -->|%.1fd| %s\n", ids[edge.From], edge.Age.Hours()/24, ids[edge.To])
+		} else {
+			output += fmt.Sprintf("  %s --> %s\n", ids[edge.From], ids[edge.To])
+		}
+		if edge.Stale {
+			stale = append(stale, strconv.Itoa(i))
+		}
+	}
+	if len(orphans) > 0 {
+		output += "  classDef noInbound stroke:#d00,stroke-width:3px\n"
+		output += fmt.Sprintf("  class %s noInbound\n", strings.Join(orphans, ","))
+	}
+	if len(stale) > 0 {
+		output += fmt.Sprintf("  linkStyle %s stroke:#d00,stroke-dasharray:5\n", strings.Join(stale, ","))
+	}
+	return output
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// graphSnapshot is the stable upgrade graph as seen by a previous run, persisted so edges that vanish can be detected
+type graphSnapshot struct {
+	Taken time.Time `json:"taken"`
+	Edges GraphMap  `json:"edges"`
+}
+
+// removedEdge is an upgrade edge that was present in the previous snapshot but is missing from the current graph
+type removedEdge struct {
+	from  string
+	to    string
+	minor int
+}
+
+// intoGA reports whether the edge led into a generally available release
+func (e removedEdge) intoGA() bool {
+	return gaVersionRegex.MatchString(e.to)
+}
+
+func graphSnapshotPath(dir, arch, channel string) string {
+	return filepath.Join(dir, fmt.Sprintf("graph-%s-%s.json", arch, channel))
+}
+
+// loadGraphSnapshot reads a snapshot, returning nil without an error when none has been taken yet
+func loadGraphSnapshot(path string) (*graphSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading graph snapshot %s: %w", path, err)
+	}
+	snapshot := &graphSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("error decoding graph snapshot %s: %w", path, err)
+	}
+	return snapshot, nil
+}
+
+// saveGraphSnapshot replaces the snapshot at path
+func saveGraphSnapshot(path string, snapshot *graphSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("error encoding graph snapshot: %w", err)
+	}
+	if err := writeFileAtomically(path, data); err != nil {
+		return fmt.Errorf("error writing graph snapshot: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomically writes data through a temporary file in the same directory that then replaces path, so an
+// interrupted write never corrupts the previous content.  Every write gets its own temporary file, so concurrent
+// writers never interleave their content.
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// diffGraphSnapshots returns the edges between named releases that are in previous but not in current.  Every minor is
+// compared, whatever range the run reports on, since the snapshot is replaced by each run and an edge missed by one run
+// would never be reported.  Edges from or into ci and nightly payloads are left out, since those payloads are routinely
+// garbage collected, which takes their edges with them.
+func diffGraphSnapshots(previous, current GraphMap) []removedEdge {
+	removed := []removedEdge{}
+	for to, froms := range previous {
+		m := namedVersionRegex.FindStringSubmatch(to)
+		if m == nil {
+			continue
+		}
+		minor, _ := strconv.Atoi(m[1])
+		remaining := make(map[string]struct{}, len(current[to]))
+		for _, from := range current[to] {
+			remaining[from] = struct{}{}
+		}
+		for _, from := range froms {
+			if !namedVersionRegex.MatchString(from) {
+				continue
+			}
+			if _, ok := remaining[from]; !ok {
+				removed = append(removed, removedEdge{from: from, to: to, minor: minor})
+			}
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		if removed[i].minor != removed[j].minor {
+			return removed[i].minor > removed[j].minor
+		}
+		if removed[i].to != removed[j].to {
+			return removed[i].to < removed[j].to
+		}
+		return removed[i].from < removed[j].from
+	})
+	return removed
+}
+
+// removedEdgesString describes the removed edges grouped by target minor
+func (rep *report) removedEdgesString() string {
+	if len(rep.removedEdges) == 0 {
+		return ""
+	}
+	output := fmt.Sprintf("Upgrade edges removed from the stable graph since the previous run %.1f days ago:\n", time.Since(rep.previousSnapshot).Hours()/24)
+	minor := -1
+	for _, edge := range rep.removedEdges {
+		if edge.minor != minor {
+			minor = edge.minor
+			output += fmt.Sprintf("  4.%d:\n", minor)
+		}
+		if rep.alertOnGAEdgeRemoval && edge.intoGA() {
+			output += fmt.Sprintf("    * *ALERT:* %s -> %s was removed from a generally available release\n", edge.from, edge.to)
+		} else {
+			output += fmt.Sprintf("    * %s -> %s\n", edge.from, edge.to)
+		}
+	}
+	return output
+}
+
+// gaEdgesRemoved reports whether any edge into a generally available release was removed
+func (rep *report) gaEdgesRemoved() bool {
+	for _, edge := range rep.removedEdges {
+		if edge.intoGA() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"k8s.io/klog"
+)
+
+var (
+	// a bare minor version such as 4.16, which is shorthand for the nightly stream of that release
+	minorOnlyRegex = regexp.MustCompile(`^4\.([1-9][0-9]*)$`)
+)
+
+// jobFailures tracks how often a single blocking job rejected payloads in a stream
+type jobFailures struct {
+	name         string
+	rejections   int
+	soleCause    int
+	passes       int
+	retried      int
+	firstFailure time.Time
+	lastFailure  time.Time
+	lastURL      string
+}
+
+// flaky reports whether the job shows signs of being intermittent rather than consistently broken
+func (j *jobFailures) flaky() bool {
+	return (j.passes > 0 && j.rejections > 0) || j.retried > 0
+}
+
+type jobsReport struct {
+	stream        string
+	releaseAPIUrl string
+	window        time.Duration
+	payloads      int
+	rejected      int
+	jobs          []*jobFailures
+}
+
+// normalizeStream expands a bare minor version (e.g. "4.16") into its nightly stream name
+func normalizeStream(stream string) string {
+	if minorOnlyRegex.MatchString(stream) {
+		return stream + ".0-0.nightly"
+	}
+	return stream
+}
+
+func generateJobsReport(stream string, window time.Duration, arch string) (*jobsReport, error) {
+	releaseAPIUrl, found := releaseAPIUrls[arch]
+	if !found {
+		return nil, fmt.Errorf("unknown architecture: %s", arch)
+	}
+	stream = normalizeStream(stream)
+
+	tags, err := getReleaseStreamTags(releaseAPIUrl, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &jobsReport{
+		stream:        stream,
+		releaseAPIUrl: releaseAPIUrl,
+		window:        window,
+	}
+	jobs := make(map[string]*jobFailures)
+	getJob := func(name string) *jobFailures {
+		if _, ok := jobs[name]; !ok {
+			jobs[name] = &jobFailures{name: name}
+		}
+		return jobs[name]
+	}
+
+	now := time.Now()
+	for _, tag := range tags.Tags {
+		ts, err := getPayloadTimestamp(tag.Name)
+		if err != nil {
+			klog.Errorf("unable to get payload timestamp: %v", err)
+			continue
+		}
+		if now.Sub(ts) > window {
+			continue
+		}
+		if tag.Phase != phaseAccepted && tag.Phase != phaseRejected {
+			klog.V(4).Infof("Ignoring payload %s in phase %s\n", tag.Name, tag.Phase)
+			continue
+		}
+		rep.payloads++
+
+		info, err := getReleaseInfo(releaseAPIUrl, stream, tag.Name)
+		if err != nil {
+			klog.Errorf("unable to get release info: %v", err)
+			continue
+		}
+		if info.Results == nil {
+			continue
+		}
+
+		var failed []string
+		for name, status := range info.Results.BlockingJobs {
+			job := getJob(name)
+			if status.Retries > 0 {
+				job.retried++
+			}
+			switch status.State {
+			case jobStateSucceeded:
+				job.passes++
+			case jobStateFailed:
+				if tag.Phase != phaseRejected {
+					continue
+				}
+				failed = append(failed, name)
+				failedAt := ts
+				if status.TransitionTime != nil {
+					failedAt = *status.TransitionTime
+				}
+				job.rejections++
+				if job.firstFailure.IsZero() || failedAt.Before(job.firstFailure) {
+					job.firstFailure = failedAt
+				}
+				if failedAt.After(job.lastFailure) {
+					job.lastFailure = failedAt
+					job.lastURL = status.URL
+				}
+			}
+		}
+		if tag.Phase == phaseRejected {
+			rep.rejected++
+			if len(failed) == 1 {
+				jobs[failed[0]].soleCause++
+			}
+		}
+	}
+
+	for _, job := range jobs {
+		if job.rejections > 0 {
+			rep.jobs = append(rep.jobs, job)
+		}
+	}
+	sort.Slice(rep.jobs, func(i, j int) bool {
+		if rep.jobs[i].rejections != rep.jobs[j].rejections {
+			return rep.jobs[i].rejections > rep.jobs[j].rejections
+		}
+		if !rep.jobs[i].lastFailure.Equal(rep.jobs[j].lastFailure) {
+			return rep.jobs[i].lastFailure.After(rep.jobs[j].lastFailure)
+		}
+		return rep.jobs[i].name < rep.jobs[j].name
+	})
+	return rep, nil
+}
+
+func (rep *jobsReport) String() string {
+	if rep.rejected == 0 {
+		return fmt.Sprintf("No rejected payloads in %s/#%s over the last %.1f days (%d payloads examined)\n", rep.releaseAPIUrl, rep.stream, rep.window.Hours()/24, rep.payloads)
+	}
+
+	now := time.Now()
+	output := fmt.Sprintf("Blocking job failures in %s/#%s over the last %.1f days (%d of %d payloads rejected)\n\n", rep.releaseAPIUrl, rep.stream, rep.window.Hours()/24, rep.rejected, rep.payloads)
+	for i, job := range rep.jobs {
+		output += fmt.Sprintf("%d. %s\n", i+1, job.name)
+		output += fmt.Sprintf("  * Caused %d rejections (%d as the only failing blocking job)\n", job.rejections, job.soleCause)
+		output += fmt.Sprintf("  * First failed %.1f days ago, last failed %.1f days ago\n", now.Sub(job.firstFailure).Hours()/24, now.Sub(job.lastFailure).Hours()/24)
+		if job.flaky() {
+			output += fmt.Sprintf("  * *Possible flake:* passed in %d payloads, needed retries in %d payloads\n", job.passes, job.retried)
+		}
+		if job.lastURL != "" {
+			output += fmt.Sprintf("  * Most recent failure: %s\n", job.lastURL)
+		}
+		output += "\n"
+	}
+	return output
+}
@@ -3,13 +3,20 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"k8s.io/klog"
 )
 
+const (
+	lifeCycleUrl = "https://access.redhat.com/product-life-cycles/api/v1/products?name=Openshift%20Container%20Platform%204"
+)
+
 type productLifeCycleResponse struct {
 	Data []productLifeCycle `json:"data"`
 }
@@ -24,28 +31,52 @@ type productLifeCycleVersion struct {
 	Type string `json:"type"`
 }
 
-func getSupportedReleases(url string) (int, int, error) {
+// lifeCycleSource records where the supported release range came from, so the report can say how much to trust it
+type lifeCycleSource struct {
+	name string
+	// when the data was fetched, zero when it was inferred from the release controller on the spot
+	fetched time.Time
+}
+
+func (s *lifeCycleSource) String() string {
+	if s.fetched.IsZero() {
+		return s.name
+	}
+	return fmt.Sprintf("%s, %.1f hours old", s.name, time.Since(s.fetched).Hours())
+}
+
+func fetchLifeCycleData(url string) ([]byte, error) {
 	resp, err := http.Get(url)
 	if err != nil {
-		return 0, 0, fmt.Errorf("error fetching life-cycle data from %s: %s", url, err)
+		return nil, fmt.Errorf("error fetching life-cycle data from %s: %s", url, err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return 0, 0, fmt.Errorf("non-OK http response code from %s: %d", url, resp.StatusCode)
+		return nil, fmt.Errorf("non-OK http response code from %s: %d", url, resp.StatusCode)
 	}
-	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading life-cycle data from %s: %s", url, err)
+	}
+	return data, nil
+}
 
-	data := productLifeCycleResponse{}
-	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return 0, 0, fmt.Errorf("error decoding life-cycle data from %s: %s", url, err)
+// getSupportedReleases returns the oldest and newest supported minors, along with the life-cycle phase of each
+// supported minor (e.g. "Full Support", "Maintenance Support" or "Extended Update Support")
+func getSupportedReleases(data []byte, source string) (int, int, map[int]string, error) {
+	lifeCycle := productLifeCycleResponse{}
+	if err := json.Unmarshal(data, &lifeCycle); err != nil {
+		return 0, 0, nil, fmt.Errorf("error decoding life-cycle data from %s: %s", source, err)
 	}
 
-	if len(data.Data) != 1 {
-		return 0, 0, fmt.Errorf("life-cycle data from %s contains %d products, but should only contain 1", url, len(data.Data))
+	if len(lifeCycle.Data) != 1 {
+		return 0, 0, nil, fmt.Errorf("life-cycle data from %s contains %d products, but should only contain 1", source, len(lifeCycle.Data))
 	}
 
 	minSupportedRelease := -1
 	maxSupportedRelease := -1
-	for _, version := range data.Data[0].Versions {
+	phases := make(map[int]string)
+	for _, version := range lifeCycle.Data[0].Versions {
 		if version.Type == "End of life" {
 			continue
 		}
@@ -65,6 +96,7 @@ func getSupportedReleases(url string) (int, int, error) {
 			continue
 		}
 
+		phases[minor] = version.Type
 		if minSupportedRelease == -1 || minSupportedRelease > minor {
 			minSupportedRelease = minor
 		}
@@ -74,8 +106,167 @@ func getSupportedReleases(url string) (int, int, error) {
 	}
 
 	if minSupportedRelease == -1 {
-		return 0, 0, fmt.Errorf("life-cycle data from %s contains no supported releases for %s", url, data.Data[0].Name)
+		return 0, 0, nil, fmt.Errorf("life-cycle data from %s contains no supported releases for %s", source, lifeCycle.Data[0].Name)
+	}
+
+	return minSupportedRelease, maxSupportedRelease, phases, nil
+}
+
+// loadLifeCycleData returns the life-cycle data from, in order of preference: the --lifecycle-file override, a cache
+// entry younger than the TTL, the life-cycle API (refreshing the cache), or a cache entry of any age.
+func loadLifeCycleData(o *options) ([]byte, *lifeCycleSource, error) {
+	if o.lifeCycleFile != "" {
+		data, err := os.ReadFile(o.lifeCycleFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading life-cycle file %s: %w", o.lifeCycleFile, err)
+		}
+		source := &lifeCycleSource{name: "file " + o.lifeCycleFile}
+		if info, err := os.Stat(o.lifeCycleFile); err == nil {
+			source.fetched = info.ModTime()
+		}
+		return data, source, nil
 	}
 
+	var cached []byte
+	var cachedAt time.Time
+	if o.lifeCycleCache != "" {
+		if info, err := os.Stat(o.lifeCycleCache); err == nil {
+			if data, err := os.ReadFile(o.lifeCycleCache); err == nil {
+				cached, cachedAt = data, info.ModTime()
+			}
+		}
+		if cached != nil && time.Since(cachedAt) < o.lifeCycleCacheTTL {
+			return cached, &lifeCycleSource{name: "cached " + lifeCycleUrl, fetched: cachedAt}, nil
+		}
+	}
+
+	data, err := fetchLifeCycleData(lifeCycleUrl)
+	if err == nil {
+		if _, _, _, parseErr := getSupportedReleases(data, lifeCycleUrl); parseErr != nil {
+			err = parseErr
+		}
+	}
+	if err != nil {
+		if cached != nil {
+			klog.Errorf("unable to refresh life-cycle data, using the cached copy: %v", err)
+			return cached, &lifeCycleSource{name: "stale cached " + lifeCycleUrl, fetched: cachedAt}, nil
+		}
+		return nil, nil, err
+	}
+	if o.lifeCycleCache != "" {
+		if err := writeFileAtomically(o.lifeCycleCache, data); err != nil {
+			klog.Errorf("unable to cache life-cycle data in %s: %v", o.lifeCycleCache, err)
+		}
+	}
+	return data, &lifeCycleSource{name: lifeCycleUrl, fetched: time.Now()}, nil
+}
+
+// inferSupportedReleases derives the supported range from the z-streams present in the release controller, for when
+// no life-cycle data is available.  The newest stream is assumed to be the release in development.
+func inferSupportedReleases(arch string) (int, int, error) {
+	releaseAPIUrl, found := releaseAPIUrls[arch]
+	if !found {
+		return 0, 0, fmt.Errorf("unknown architecture: %s", arch)
+	}
+	releases, err := getReleaseStream(releaseAPIUrl + allReleasePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	minSupportedRelease := -1
+	maxStreamRelease := -1
+	for stream := range releases {
+		matches := zReleaseRegex.FindStringSubmatch(stream)
+		if matches == nil {
+			continue
+		}
+		minor, _ := strconv.Atoi(matches[1])
+		if minSupportedRelease == -1 || minSupportedRelease > minor {
+			minSupportedRelease = minor
+		}
+		if maxStreamRelease < minor {
+			maxStreamRelease = minor
+		}
+	}
+	if minSupportedRelease == -1 {
+		return 0, 0, fmt.Errorf("no z-streams found at %s to infer the supported releases from", releaseAPIUrl)
+	}
+	maxSupportedRelease := maxStreamRelease - 1
+	if maxSupportedRelease < minSupportedRelease {
+		maxSupportedRelease = minSupportedRelease
+	}
 	return minSupportedRelease, maxSupportedRelease, nil
 }
+
+// minorRange is the range of minors to analyze, along with what is known about their life-cycle
+type minorRange struct {
+	oldest int
+	newest int
+	// where the life-cycle data came from, nil when it was unavailable and not needed
+	source *lifeCycleSource
+	// the life-cycle phase of each supported minor, empty when the life-cycle data was unavailable.  Minors newer than
+	// the newest supported minor are pre-GA, and are in the "development" or "pre-GA" phase.
+	phases map[int]string
+}
+
+// resolveMinorRange fills in any unset (-1) bound of the minor range from the supported releases in the life-cycle
+// data, falling back to the streams present in the release controller.  An unset bound is widened to take in the
+// minors the selector names explicitly, and an explicit bound that excludes them is an error.  The life-cycle data is
+// read even when both bounds are given, for the phases of the minors, which are left unknown if it is unavailable.
+func resolveMinorRange(o *options, selector *streamSelector) (*minorRange, error) {
+	r := &minorRange{oldest: o.oldestMinor, newest: o.newestMinor, phases: make(map[int]string)}
+
+	var oldestSupportedMinor, newestSupportedMinor int
+	data, source, err := loadLifeCycleData(o)
+	if err == nil {
+		oldestSupportedMinor, newestSupportedMinor, r.phases, err = getSupportedReleases(data, source.name)
+	}
+	if err == nil {
+		r.source = source
+	} else {
+		r.phases = make(map[int]string)
+		klog.Errorf("unable to use life-cycle data, inferring supported releases from the release controller: %v", err)
+		oldestSupportedMinor, newestSupportedMinor, err = inferSupportedReleases(o.arch)
+		if err != nil {
+			if r.oldest == -1 || r.newest == -1 {
+				return nil, err
+			}
+			klog.Errorf("unable to infer the supported releases, life-cycle phases will not be known: %v", err)
+			return r, r.validate(selector)
+		}
+		r.source = &lifeCycleSource{name: "inferred from the release streams"}
+	}
+
+	if r.oldest == -1 {
+		r.oldest = oldestSupportedMinor
+		if oldest, _, ok := selector.namedMinors(); ok && oldest < r.oldest {
+			r.oldest = oldest
+		}
+	}
+	if r.newest == -1 {
+		// Adding 1 for the N+1 releases when determining newest versions ourselves
+		r.newest = newestSupportedMinor + 1
+		if _, newest, ok := selector.namedMinors(); ok && newest > r.newest {
+			r.newest = newest
+		}
+	}
+	if err := r.validate(selector); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for minor := newestSupportedMinor + 1; minor <= r.newest; minor++ {
+		r.phases[minor] = o.config.preGAPhase(minor, now)
+	}
+	return r, nil
+}
+
+// validate checks that the range is well formed and holds every minor the selector names explicitly
+func (r *minorRange) validate(selector *streamSelector) error {
+	if r.oldest < 0 || r.newest < 0 || r.newest < r.oldest {
+		return fmt.Errorf("invalid release range (%d -> %d), release versions must be non-negative and newest must be greater than oldest", r.oldest, r.newest)
+	}
+	if oldest, newest, ok := selector.namedMinors(); ok && (oldest < r.oldest || newest > r.newest) {
+		return fmt.Errorf("stream selector %q names minors outside of the release range 4.%d to 4.%d", selector, r.oldest, r.newest)
+	}
+	return nil
+}
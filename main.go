@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"time"
 
@@ -48,24 +50,64 @@ var (
 // What we do report:
 //   accepted payload is older than a day when newer builds exist in the stream - we are failing to accept payloads regularly/may have regressed
 //   no accepted builds in the stream when builds exist in the stream - we are completely failing to accept payloads, DIRE
-//   no builds exist in the stream - either there have been no changes in the code(ok) or our build system is broken (not ok).  - ????
-//   no build newer than a week exists in the stream - either there have been no changes in the code(ok) or our build system is broken (not ok).  - ????
+//   no builds exist in the stream - either there have been no changes in the code(ok) or our build system is broken (not ok).
+//   no build newer than the built staleness limit exists in the stream - either there have been no changes in the code(ok) or our build
+//     system is broken (not ok).  We classify these using the matching ci/nightly stream, the changelog between the newest payloads
+//     and the same stream on the sibling architectures (see staleness.go).
 
 type options struct {
 	oldestMinor            int
 	newestMinor            int
 	slackAlias             string
+	groupIDs               map[string]string
+	escalationStateFile    string
+	escalationInterval     time.Duration
+	escalations            *escalationState
 	acceptedStalenessLimit time.Duration
 	builtStalenessLimit    time.Duration
 	upgradeStalenessLimit  time.Duration
+	upgradeLookback        time.Duration
 	includeHealthy         bool
+	includeChangelog       bool
 	arch                   string
+	stream                 string
+	window                 time.Duration
+	configFile             string
+	config                 *config
+	sourcesPerMinor        int
+	channel                string
+	format                 string
+	highlightStale         bool
+	graphSnapshotDir       string
+	alertOnGAEdgeRemoval   bool
+	checkReleaseCadence    bool
+	lifeCycleFile          string
+	lifeCycleCache         string
+	lifeCycleCacheTTL      time.Duration
+	businessTime           bool
+	slackAPIUrl            string
+	slackTimeout           time.Duration
+	slackRetries           int
+	slack                  *slackClient
+	slackSigningSecret     string
+	eventWorkers           int
+	eventQueueSize         int
+	eventDedupeTTL         time.Duration
+	events                 chan Event
+	seenEvents             *eventCache
+	tag                    bool
+	candidate              string
+	streams                string
 }
 
 func main() {
 	root := &cobra.Command{}
 	root.AddCommand(
 		newReportCommand(),
+		newJobsCommand(),
+		newCoverageCommand(),
+		newGraphCommand(),
+		newReadinessCommand(),
 		newBotCommand(),
 	)
 
@@ -100,6 +142,99 @@ func newReportCommand() *cobra.Command {
 	return cmd
 }
 
+func newJobsCommand() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "Rank the blocking jobs responsible for rejected payloads in a release stream",
+
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.runJobs()
+		},
+	}
+	addJobsFlags(cmd.Flags(), o)
+	return cmd
+}
+
+func addJobsFlags(flagset *pflag.FlagSet, o *options) {
+	flagset.StringVar(&o.stream, "stream", "", "The release stream to analyze (e.g. \"4.16.0-0.nightly\").  A bare minor version such as \"4.16\" refers to its nightly stream")
+	flagset.DurationVar(&o.window, "window", 7*24*time.Hour, "How far back to look for rejected payloads")
+	flagset.StringVar(&o.arch, "arch", "amd64", "Which architecture to report on (amd64, arm64)")
+}
+
+func newCoverageCommand() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "coverage",
+		Short: "Print a matrix of the most recent successful upgrades into each release stream by source version",
+
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.runCoverage()
+		},
+	}
+	flagset := cmd.Flags()
+	flagset.IntVar(&o.oldestMinor, "oldest-minor", -1, "The oldest minor release to analyze.  Release streams older than this will be ignored.  Specify only the minor value (e.g. \"9\") (default to looking up the oldest supported release)")
+	flagset.IntVar(&o.newestMinor, "newest-minor", -1, "The newest minor release to analyze.  Release streams newer than this will be ignored.  Specify only the minor value (e.g. \"12\") (default to looking up the newest supported release)")
+	flagset.DurationVar(&o.upgradeStalenessLimit, "upgrade-staleness-limit", 72*time.Hour, "How old a successful upgrade attempt can be before it's considered stale")
+	flagset.DurationVar(&o.window, "window", 14*24*time.Hour, "How far back to look for upgrades.  The upgrade results of older payloads are not fetched")
+	flagset.IntVar(&o.sourcesPerMinor, "sources-per-minor", 5, "How many of the newest named releases of each source minor to include.  0 includes all of them")
+	flagset.StringVar(&o.arch, "arch", "amd64", "Which architecture to report on (amd64, arm64)")
+	flagset.StringVar(&o.configFile, "config", "", "Path to a json configuration file, whose normalRulesFrom dates label the minors that have not shipped yet")
+	addLifeCycleFlags(flagset, o)
+	return cmd
+}
+
+func newGraphCommand() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Export the upgrade graph as Graphviz DOT, Mermaid or JSON",
+
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.runGraph()
+		},
+	}
+	flagset := cmd.Flags()
+	flagset.IntVar(&o.oldestMinor, "oldest-minor", -1, "The oldest minor release to export.  Specify only the minor value (e.g. \"9\") (default to looking up the oldest supported release)")
+	flagset.IntVar(&o.newestMinor, "newest-minor", -1, "The newest minor release to export.  Specify only the minor value (e.g. \"12\") (default to looking up the newest supported release)")
+	flagset.StringVar(&o.channel, "channel", "stable", "The upgrade graph channel to export (stable, nightly, prerelease)")
+	flagset.StringVar(&o.format, "format", graphFormatDOT, "The output format (dot, mermaid, json)")
+	flagset.BoolVar(&o.highlightStale, "highlight-stale", false, "Look up when each upgrade last succeeded and highlight edges older than the upgrade staleness limit")
+	flagset.DurationVar(&o.upgradeStalenessLimit, "upgrade-staleness-limit", 72*time.Hour, "How old a successful upgrade attempt can be before it's considered stale")
+	flagset.StringVar(&o.arch, "arch", "amd64", "Which architecture to export (amd64, arm64)")
+	flagset.StringVar(&o.configFile, "config", "", "Path to a json configuration file, whose normalRulesFrom dates label the minors that have not shipped yet")
+	addLifeCycleFlags(flagset, o)
+	return cmd
+}
+
+func newReadinessCommand() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "readiness MINOR|PAYLOAD",
+		Short: "Check whether a minor's newest accepted nightly, or a specific nightly payload, is ready to be cut as a z release",
+		Args:  cobra.ExactArgs(1),
+
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.runReadiness(args[0])
+		},
+	}
+	addReadinessFlags(cmd.Flags(), o)
+	return cmd
+}
+
+func addReadinessFlags(flagset *pflag.FlagSet, o *options) {
+	flagset.StringVar(&o.arch, "arch", "amd64", "Which architecture to report on (amd64, arm64)")
+	flagset.DurationVar(&o.upgradeStalenessLimit, "upgrade-staleness-limit", 72*time.Hour, "How old a successful upgrade can be before it no longer counts towards readiness")
+}
+
 func newBotCommand() *cobra.Command {
 	o := &options{}
 	cmd := &cobra.Command{
@@ -114,7 +249,16 @@ func newBotCommand() *cobra.Command {
 	}
 
 	flagset := cmd.Flags()
-	flagset.StringVar(&o.slackAlias, "slack-alias", "", "Slack alias to tag in the generated report.  Leave empty to not tag anyone.")
+	flagset.StringVar(&o.slackAlias, "slack-alias", "", "Handle or id of the Slack user group the report command tags when asked to (default the patch manager group)")
+	flagset.DurationVar(&o.window, "window", 7*24*time.Hour, "How far back the jobs command looks for rejected payloads by default")
+	flagset.StringVar(&o.slackAPIUrl, "slack-api-url", defaultSlackAPIUrl, "The base url of the Slack Web API")
+	flagset.DurationVar(&o.slackTimeout, "slack-timeout", 30*time.Second, "How long a single call to the Slack Web API may take")
+	flagset.IntVar(&o.slackRetries, "slack-retries", 3, "How many times a rate limited or failed call to the Slack Web API is retried")
+	flagset.IntVar(&o.eventWorkers, "event-workers", 2, "How many Slack events are processed at the same time")
+	flagset.IntVar(&o.eventQueueSize, "event-queue-size", 20, "How many Slack events may wait to be processed before Slack is asked to retry them later")
+	flagset.DurationVar(&o.eventDedupeTTL, "event-dedupe-ttl", time.Hour, "How long Slack event ids are remembered to ignore retries of events that were already handled")
+	flagset.StringVar(&o.escalationStateFile, "escalation-state", "", "File in which to keep how long streams have been unhealthy and who acknowledged them, so escalations survive restarts.  Leave empty to keep it in memory only")
+	flagset.DurationVar(&o.escalationInterval, "escalation-interval", time.Hour, "How often the bot reports on its own settings to escalate the streams that stay unhealthy.  Set to 0 to only escalate when the report command is run, e.g. by a scheduled message")
 	addSharedFlags(flagset, o)
 	return cmd
 }
@@ -125,20 +269,101 @@ func addSharedFlags(flagset *pflag.FlagSet, o *options) {
 	flagset.DurationVar(&o.acceptedStalenessLimit, "accepted-staleness-limit", 24*time.Hour, "How old an accepted payload can be before it is considered stale")
 	flagset.DurationVar(&o.builtStalenessLimit, "built-staleness-limit", 72*time.Hour, "How old an built payload can be before it is considered stale")
 	flagset.DurationVar(&o.upgradeStalenessLimit, "upgrade-staleness-limit", 72*time.Hour, "How old a successful upgrade attempt can be before it's considered stale")
+	flagset.DurationVar(&o.upgradeLookback, "upgrade-lookback", 14*24*time.Hour, "How far back to look for payloads whose upgrade results are counted.  Upgrades into older payloads are not fetched, even when they were run recently")
 	flagset.BoolVar(&o.includeHealthy, "include-healthy", false, "Report about healthy payloads, not just failures")
+	flagset.BoolVar(&o.includeChangelog, "include-changelog", true, "Include the changes between the last accepted and newest rejected payload for streams with stale acceptance")
 	flagset.StringVar(&o.arch, "arch", "amd64", "Which architecture to report on (amd64, arm64)")
+	flagset.BoolVar(&o.checkReleaseCadence, "check-release-cadence", true, "Check how recently each minor shipped a z release, or a candidate for minors in development, on the stable and dev-preview streams")
+	flagset.StringVar(&o.graphSnapshotDir, "graph-snapshot-dir", "", "Directory in which to keep a snapshot of the stable upgrade graph between runs, to report upgrade edges that disappeared.  Leave empty to disable")
+	flagset.BoolVar(&o.alertOnGAEdgeRemoval, "alert-on-ga-edge-removal", false, "Flag upgrade edges removed from generally available releases as alerts")
+	flagset.StringVar(&o.configFile, "config", "", "Path to a json configuration file declaring the required upgrade paths.  Leave empty to require any recent patch and minor level upgrade")
+	flagset.StringVar(&o.streams, "streams", "", "Which streams to report on, as comma separated terms, e.g. \"4.14-4.16\", \"4.14,4.16\", \"eus,nightly\", \"supported\", \"4.17.0-0.ci\" or \"/regex/\".  Leave empty for every stream in the minor range")
+	flagset.BoolVar(&o.businessTime, "business-time", false, "Measure the age of payloads in business time, skipping the weekends and holidays of the calendar in the configuration file")
+	addLifeCycleFlags(flagset, o)
+}
+
+func addLifeCycleFlags(flagset *pflag.FlagSet, o *options) {
+	flagset.StringVar(&o.lifeCycleFile, "lifecycle-file", "", "Read the product life-cycle data from this file instead of access.redhat.com, for air-gapped use")
+	flagset.StringVar(&o.lifeCycleCache, "lifecycle-cache", filepath.Join(os.TempDir(), "release-watcher-lifecycle.json"), "File in which to cache the product life-cycle data.  Leave empty to disable caching")
+	flagset.DurationVar(&o.lifeCycleCacheTTL, "lifecycle-cache-ttl", 24*time.Hour, "How long cached product life-cycle data is used before it is fetched again")
 }
 
 func (o *options) runReport() error {
-	report, err := generateReport(o.acceptedStalenessLimit, o.builtStalenessLimit, o.upgradeStalenessLimit, o.oldestMinor, o.newestMinor, o.arch)
+	cfg, err := loadConfig(o.configFile)
+	if err != nil {
+		return err
+	}
+	o.config = cfg
+	report, err := generateReport(o)
 	if err != nil {
 		return err
 	}
 	fmt.Println(report.String(o.includeHealthy))
+	if details := report.changelogDetails(); details != "" {
+		fmt.Println(details)
+	}
+	return nil
+}
+
+func (o *options) runJobs() error {
+	if o.stream == "" {
+		return fmt.Errorf("--stream is required")
+	}
+	report, err := generateJobsReport(o.stream, o.window, o.arch)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report.String())
+	return nil
+}
+
+func (o *options) runCoverage() error {
+	cfg, err := loadConfig(o.configFile)
+	if err != nil {
+		return err
+	}
+	o.config = cfg
+	matrix, err := generateCoverageMatrix(o)
+	if err != nil {
+		return err
+	}
+	fmt.Println(matrix.String())
+	return nil
+}
+
+func (o *options) runGraph() error {
+	cfg, err := loadConfig(o.configFile)
+	if err != nil {
+		return err
+	}
+	o.config = cfg
+	graph, err := generateGraphExport(o)
+	if err != nil {
+		return err
+	}
+	output, err := graph.render(o.format)
+	if err != nil {
+		return err
+	}
+	fmt.Println(output)
+	return nil
+}
+
+func (o *options) runReadiness(candidate string) error {
+	report, err := generateReadinessReport(candidate, o.arch, o.upgradeStalenessLimit)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report.String())
 	return nil
 }
 
 func (o *options) runBot() error {
+	cfg, err := loadConfig(o.configFile)
+	if err != nil {
+		return err
+	}
+	o.config = cfg
 	o.serve()
 	return nil
 }
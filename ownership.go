@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+var (
+	// the id of a Slack user group, e.g. "SMZ7PJ1L0", which may be given in place of its handle
+	userGroupIDRegex = regexp.MustCompile(`^S[A-Z0-9]{6,}$`)
+	ownedChecks      = []string{checkAccepted, checkBuilt, checkUpgrade, checkCadence}
+)
+
+// owner routes the unhealthy findings matching all of its filters to a Slack user group.  Empty filters match
+// everything.
+type owner struct {
+	// Group is the handle of the Slack user group, e.g. "multiarch-team", or its id
+	Group string `json:"group"`
+	// Arches restricts the owner to reports on the given architectures, e.g. ["arm64", "multi"]
+	Arches []string `json:"arches,omitempty"`
+	// Minors restricts the owner to the streams of the given minors, e.g. ["4.16"]
+	Minors []string `json:"minors,omitempty"`
+	// Checks restricts the owner to findings of the given checks: "accepted", "built", "upgrade" or "cadence"
+	Checks []string `json:"checks,omitempty"`
+
+	minors map[int]struct{}
+}
+
+// quietHours is the time of day during which the bot does not tag anyone, e.g. from "20:00" to "08:00"
+type quietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Location is the time zone of Start and End, e.g. "Europe/Prague" (default UTC)
+	Location string `json:"location,omitempty"`
+
+	start    time.Duration
+	end      time.Duration
+	location *time.Location
+}
+
+func (ow *owner) complete(i int) error {
+	if ow.Group == "" {
+		return fmt.Errorf("owner %d has no group", i)
+	}
+	for _, check := range ow.Checks {
+		if !contains(ownedChecks, check) {
+			return fmt.Errorf("owner %q has unknown check %q, must be one of %s", ow.Group, check, strings.Join(ownedChecks, ", "))
+		}
+	}
+	ow.minors = make(map[int]struct{}, len(ow.Minors))
+	for _, version := range ow.Minors {
+		m := minorOnlyRegex.FindStringSubmatch(version)
+		if m == nil {
+			return fmt.Errorf("owner %q minor %q must be a minor such as \"4.16\"", ow.Group, version)
+		}
+		minor, _ := strconv.Atoi(m[1])
+		ow.minors[minor] = struct{}{}
+	}
+	return nil
+}
+
+// owns reports whether the owner is responsible for a finding of the check on a stream of the minor
+func (ow *owner) owns(arch string, minor int, check string) bool {
+	if len(ow.Arches) > 0 && !contains(ow.Arches, arch) {
+		return false
+	}
+	if len(ow.Checks) > 0 && !contains(ow.Checks, check) {
+		return false
+	}
+	if len(ow.minors) > 0 {
+		if _, ok := ow.minors[minor]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *quietHours) complete() error {
+	q.location = time.UTC
+	if q.Location != "" {
+		location, err := time.LoadLocation(q.Location)
+		if err != nil {
+			return fmt.Errorf("quiet hours have an unknown location %q: %w", q.Location, err)
+		}
+		q.location = location
+	}
+	for _, bound := range []struct {
+		value string
+		into  *time.Duration
+	}{{q.Start, &q.start}, {q.End, &q.end}} {
+		t, err := time.Parse("15:04", bound.value)
+		if err != nil {
+			return fmt.Errorf("quiet hours must be formatted as HH:MM, e.g. \"20:00\": %w", err)
+		}
+		*bound.into = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return nil
+}
+
+// active reports whether t falls within the quiet hours, which may span midnight
+func (q *quietHours) active(t time.Time) bool {
+	if q == nil {
+		return false
+	}
+	t = t.In(q.location)
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if q.start <= q.end {
+		return now >= q.start && now < q.end
+	}
+	return now >= q.start || now < q.end
+}
+
+// owners returns the groups responsible for a finding of the check on a stream of the minor
+func (c *config) owners(arch string, minor int, check string) []string {
+	groups := []string{}
+	for i := range c.Owners {
+		if c.Owners[i].owns(arch, minor, check) && !contains(groups, c.Owners[i].Group) {
+			groups = append(groups, c.Owners[i].Group)
+		}
+	}
+	return groups
+}
+
+// ownerGroups returns every group named by the owners
+func (c *config) ownerGroups() []string {
+	groups := []string{}
+	for _, ow := range c.Owners {
+		if !contains(groups, ow.Group) {
+			groups = append(groups, ow.Group)
+		}
+	}
+	return groups
+}
+
+// mentionOwners sets the mention of the owners of each unhealthy finding, and returns the mentions of every owner
+// tagged in the report, sorted
+func (rep *report) mentionOwners(cfg *config, mention func(group string) string) []string {
+	tagged := map[string]struct{}{}
+	for _, streamReport := range rep.streams {
+		streamReport.unhealthyMentions = make([]string, len(streamReport.unhealthyMessages))
+		for i := range streamReport.unhealthyMessages {
+			mentions := []string{}
+			for _, group := range cfg.owners(rep.arch, streamReport.unhealthyMinors[i], streamReport.unhealthyChecks[i]) {
+				m := mention(group)
+				mentions = append(mentions, m)
+				tagged[m] = struct{}{}
+			}
+			streamReport.unhealthyMentions[i] = strings.Join(mentions, " ")
+		}
+	}
+	all := make([]string, 0, len(tagged))
+	for m := range tagged {
+		all = append(all, m)
+	}
+	sort.Strings(all)
+	return all
+}
+
+// mention returns the owners of the i-th unhealthy finding to append to it, or "" if none are tagged
+func (r *releaseReport) mention(i int) string {
+	if i >= len(r.unhealthyMentions) || r.unhealthyMentions[i] == "" {
+		return ""
+	}
+	return " " + r.unhealthyMentions[i]
+}
+
+type userGroup struct {
+	ID     string `json:"id"`
+	Handle string `json:"handle"`
+}
+
+type userGroupsResponse struct {
+	UserGroups []userGroup `json:"usergroups"`
+}
+
+// userGroupIDs looks up the ids of the workspace's user groups by handle, with usergroups.list
+func (c *slackClient) userGroupIDs() (map[string]string, error) {
+	resp := &userGroupsResponse{}
+	if err := c.call("usergroups.list", struct{}{}, resp); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]string, len(resp.UserGroups))
+	for _, group := range resp.UserGroups {
+		ids[group.Handle] = group.ID
+	}
+	return ids, nil
+}
+
+// resolveGroups looks up the ids of the groups the bot tags.  Groups that cannot be resolved are logged and
+// mentioned by name, which Slack shows without notifying anyone.
+func (o *options) resolveGroups() {
+	groups := o.config.ownerGroups()
+	for _, level := range o.config.Escalations {
+		for _, group := range level.Groups {
+			if !contains(groups, group) {
+				groups = append(groups, group)
+			}
+		}
+	}
+	if o.slackAlias != "" {
+		groups = append(groups, o.slackAlias)
+	}
+	if len(groups) == 0 {
+		return
+	}
+	ids, err := o.slack.userGroupIDs()
+	if err != nil {
+		klog.Errorf("unable to look up the slack user groups: %v", err)
+		ids = map[string]string{}
+	}
+	o.groupIDs = make(map[string]string, len(groups))
+	for _, group := range groups {
+		handle := strings.TrimPrefix(group, "@")
+		switch id, ok := ids[handle]; {
+		case ok:
+			o.groupIDs[group] = id
+		case userGroupIDRegex.MatchString(group):
+			o.groupIDs[group] = group
+		default:
+			klog.Errorf("unknown slack user group %q, it will be named but not notified", group)
+		}
+	}
+}
+
+// groupMention returns the Slack markup that notifies a group
+func (o *options) groupMention(group string) string {
+	if id, ok := o.groupIDs[group]; ok {
+		return fmt.Sprintf("<!subteam^%s>", id)
+	}
+	return "@" + strings.TrimPrefix(group, "@")
+}
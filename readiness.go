@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// readinessCheck is a single requirement a candidate payload must meet before a z release can be cut from it
+type readinessCheck struct {
+	passed  bool
+	message string
+}
+
+type readinessReport struct {
+	releaseAPIUrl string
+	stream        string
+	payload       string
+	checks        []readinessCheck
+}
+
+// ready is the go/no-go verdict: every check must pass
+func (r *readinessReport) ready() bool {
+	for _, check := range r.checks {
+		if !check.passed {
+			return false
+		}
+	}
+	return len(r.checks) > 0
+}
+
+func (r *readinessReport) verdict() string {
+	if r.ready() {
+		return "GO"
+	}
+	return "NO-GO"
+}
+
+func (r *readinessReport) String() string {
+	output := fmt.Sprintf("Readiness of %s (%s/#%s): *%s*\n", r.payload, r.releaseAPIUrl, r.stream, r.verdict())
+	for _, check := range r.checks {
+		if check.passed {
+			output += fmt.Sprintf("  * %s\n", check.message)
+		} else {
+			output += fmt.Sprintf("  * *FAILED:* %s\n", check.message)
+		}
+	}
+	return output
+}
+
+// generateReadinessReport evaluates a candidate, which is either a minor (e.g. "4.16"), in which case the newest
+// accepted payload of its nightly stream is the candidate, or the name of a specific nightly payload.  An upgrade only
+// counts when it succeeded within the staleness limit.
+func generateReadinessReport(candidate, arch string, stalenessLimit time.Duration) (*readinessReport, error) {
+	releaseAPIUrl, found := releaseAPIUrls[arch]
+	if !found {
+		return nil, fmt.Errorf("unknown architecture: %s", arch)
+	}
+
+	r := &readinessReport{releaseAPIUrl: releaseAPIUrl}
+	if m := minorOnlyRegex.FindStringSubmatch(candidate); m != nil {
+		r.stream = siblingStream(normalizeStream(candidate), "amd64", arch)
+		tags, err := getReleaseStreamTags(releaseAPIUrl, r.stream)
+		if err != nil {
+			return nil, err
+		}
+		var newest time.Time
+		for _, tag := range tags.Tags {
+			if tag.Phase != phaseAccepted {
+				continue
+			}
+			ts, err := getPayloadTimestamp(tag.Name)
+			if err != nil {
+				continue
+			}
+			if ts.After(newest) {
+				r.payload, newest = tag.Name, ts
+			}
+		}
+		if r.payload == "" {
+			return nil, fmt.Errorf("no accepted payloads found in %s", r.stream)
+		}
+	} else {
+		stream, ok := payloadStream(candidate)
+		if !ok {
+			return nil, fmt.Errorf("%q is neither a minor (e.g. 4.16) nor a payload name", candidate)
+		}
+		r.stream, r.payload = stream, candidate
+	}
+
+	m := extractMinorRegex.FindStringSubmatch(r.payload)
+	if m == nil {
+		return nil, fmt.Errorf("unable to determine the minor version of %s", r.payload)
+	}
+	minor, _ := strconv.Atoi(m[1])
+
+	info, err := getReleaseInfo(releaseAPIUrl, r.stream, r.payload)
+	if err != nil {
+		return nil, err
+	}
+	r.checks = append(r.checks, readinessCheck{
+		passed:  info.Phase == phaseAccepted,
+		message: fmt.Sprintf("Payload is %s", info.Phase),
+	})
+
+	shipped, failed := getShippedReleases(releaseAPIUrl, arch)
+	if err := failed[siblingStream(stableStream, "amd64", arch)]; err != nil {
+		return nil, err
+	}
+	stableGraph, attemptedGraph, err := getUpgradeGraphs(releaseAPIUrl)
+	if err != nil {
+		return nil, err
+	}
+	results := getUpgradeResults(releaseAPIUrl, r.stream, r.payload, stableGraph, attemptedGraph)
+
+	now := time.Now()
+	for _, sourceMinor := range []int{minor, minor - 1} {
+		var source string
+		for _, release := range shipped[sourceMinor] {
+			if gaVersionRegex.MatchString(release.version) {
+				source = release.version
+				break
+			}
+		}
+		if source == "" {
+			if sourceMinor == minor {
+				// a minor that has not shipped yet has no z release to upgrade from
+				continue
+			}
+			r.checks = append(r.checks, readinessCheck{message: fmt.Sprintf("No generally available 4.%d.z release found to upgrade from", sourceMinor)})
+			continue
+		}
+
+		var newest *upgradeResult
+		failures := 0
+		for i := range results {
+			if results[i].from != source {
+				continue
+			}
+			if !results[i].succeeded {
+				failures++
+				continue
+			}
+			if newest == nil || results[i].ran.After(newest.ran) {
+				newest = &results[i]
+			}
+		}
+		switch {
+		case newest == nil && failures > 0:
+			r.checks = append(r.checks, readinessCheck{message: fmt.Sprintf("Upgrade from the latest 4.%d.z (%s) failed %d times and never succeeded", sourceMinor, source, failures)})
+		case newest == nil:
+			r.checks = append(r.checks, readinessCheck{message: fmt.Sprintf("Upgrade from the latest 4.%d.z (%s) has not been attempted", sourceMinor, source)})
+		default:
+			age := now.Sub(newest.ran)
+			msg := fmt.Sprintf("Upgrade from the latest 4.%d.z (%s) succeeded %.1f days ago", sourceMinor, source, age.Hours()/24)
+			if age > stalenessLimit {
+				msg += fmt.Sprintf(", more than the %.1f day limit", stalenessLimit.Hours()/24)
+			}
+			if failures > 0 {
+				msg += fmt.Sprintf(" (%d failed attempts)", failures)
+			}
+			if newest.url != "" {
+				msg += ": " + newest.url
+			}
+			r.checks = append(r.checks, readinessCheck{passed: age <= stalenessLimit, message: msg})
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	releaseStreamTagsPath = "/api/v1/releasestream/%s/tags"
+	releaseInfoPath       = "/api/v1/releasestream/%s/release/%s"
+
+	phaseAccepted = "Accepted"
+	phaseRejected = "Rejected"
+
+	jobStateSucceeded = "Succeeded"
+	jobStateFailed    = "Failed"
+)
+
+// releaseStreamTags is the release controller's listing of all payloads in a stream along with their phase
+type releaseStreamTags struct {
+	Name string       `json:"name"`
+	Tags []releaseTag `json:"tags"`
+}
+
+type releaseTag struct {
+	Name     string `json:"name"`
+	Phase    string `json:"phase"`
+	PullSpec string `json:"pullSpec"`
+}
+
+// releaseInfo is the subset of the release controller's per-payload details that we care about
+type releaseInfo struct {
+	Name       string               `json:"name"`
+	Phase      string               `json:"phase"`
+	Results    *verificationResults `json:"results,omitempty"`
+	UpgradesTo []upgradeHistory     `json:"upgradesTo,omitempty"`
+	// ChangeLogJson is the changelog from the previous payload, which also records when this payload was created
+	ChangeLogJson *changeLog `json:"changeLogJson,omitempty"`
+}
+
+type verificationResults struct {
+	BlockingJobs  map[string]verificationStatus `json:"blockingJobs,omitempty"`
+	InformingJobs map[string]verificationStatus `json:"informingJobs,omitempty"`
+}
+
+type verificationStatus struct {
+	State          string     `json:"state"`
+	URL            string     `json:"url"`
+	Retries        int        `json:"retries,omitempty"`
+	TransitionTime *time.Time `json:"transitionTime,omitempty"`
+}
+
+// upgradeHistory holds every recorded run of the upgrade job along a single edge of the upgrade graph
+type upgradeHistory struct {
+	From    string                          `json:"from"`
+	To      string                          `json:"to"`
+	Success int                             `json:"success"`
+	Failure int                             `json:"failure"`
+	Total   int                             `json:"total"`
+	History map[string]upgradeHistoryResult `json:"history"`
+}
+
+type upgradeHistoryResult struct {
+	State string `json:"state"`
+	URL   string `json:"url"`
+	// unix time at which the upgrade job finished, zero when the release controller did not record it
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
+func getJSON(url string, v interface{}) error {
+	res, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %s", url, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("non-OK http response code from %s: %d", url, res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding response from %s: %v", url, err)
+	}
+	return nil
+}
+
+func getReleaseStreamTags(releaseAPIUrl, stream string) (*releaseStreamTags, error) {
+	tags := &releaseStreamTags{}
+	if err := getJSON(releaseAPIUrl+fmt.Sprintf(releaseStreamTagsPath, url.PathEscape(stream)), tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// getPayloadCreated returns when a payload was created.  Named releases such as 4.15.23 carry no date in their name,
+// so the creation time is read from the changelog the release controller records for the payload.
+func getPayloadCreated(releaseAPIUrl, stream, payload string) (time.Time, error) {
+	info, err := getReleaseInfo(releaseAPIUrl, stream, payload)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if info.ChangeLogJson == nil || info.ChangeLogJson.To.Created.IsZero() {
+		return time.Time{}, fmt.Errorf("no creation time recorded for %s in %s", payload, stream)
+	}
+	return info.ChangeLogJson.To.Created, nil
+}
+
+func getReleaseInfo(releaseAPIUrl, stream, payload string) (*releaseInfo, error) {
+	info := &releaseInfo{}
+	if err := getJSON(releaseAPIUrl+fmt.Sprintf(releaseInfoPath, url.PathEscape(stream), url.PathEscape(payload)), info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
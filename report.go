@@ -3,18 +3,43 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"k8s.io/klog"
 )
 
+const (
+	// the kinds of check a finding comes from, which decide who owns it
+	checkAccepted = "accepted"
+	checkBuilt    = "built"
+	checkUpgrade  = "upgrade"
+	checkCadence  = "cadence"
+)
+
 type releaseReport struct {
 	healthyMessages   []string
 	unhealthyMessages []string
+	// the check and minor each unhealthy message is about, and the mention of its owners if they are tagged.  The minor
+	// is that of the stream, except for the findings of streams spanning every minor such as 4-stable.
+	unhealthyChecks   []string
+	unhealthyMinors   []int
+	unhealthyMentions []string
+	// the escalation of the stream's findings, and whether they can be acknowledged to pause it, set by the bot
+	escalation      string
+	acknowledgeable bool
+	// changes between the last accepted and newest rejected payload, set when acceptance is stale
+	changelog *acceptanceChangelog
+	// the life-cycle phase of the stream's minor, if known, and the severity of its findings
+	phase    string
+	severity string
+	// whether a freeze window suppressed the stream's findings
+	suppressed bool
 }
 
 type report struct {
@@ -22,29 +47,48 @@ type report struct {
 	oldestMinor   int
 	newestMinor   int
 	releaseAPIUrl string
+	arch          string
+	// upgrade edges that disappeared from the stable graph since the snapshot taken at previousSnapshot
+	removedEdges         []removedEdge
+	previousSnapshot     time.Time
+	alertOnGAEdgeRemoval bool
+	// where the supported release range came from, nil when both bounds were given explicitly
+	lifeCycleSource *lifeCycleSource
+	// whether payload ages were measured in business time, and how freeze windows changed the findings
+	businessTime bool
+	freezeNotes  []string
+	// the selector limiting the streams reported on, nil when every stream in the minor range is
+	selector *streamSelector
 }
 
-func generateReport(acceptedStalenessLimit, builtStalenessLimit, upgradeStalenessLimit time.Duration, oldestMinor, newestMinor int, arch string) (*report, error) {
-	if oldestMinor == -1 || newestMinor == -1 {
-		oldestSupportedMinor, newestSupportedMinor, err := getSupportedReleases("https://access.redhat.com/product-life-cycles/api/v1/products?name=Openshift%20Container%20Platform%204")
-		if err != nil {
-			return nil, err
-		}
-		if oldestMinor == -1 {
-			oldestMinor = oldestSupportedMinor
-		}
-		if newestMinor == -1 {
-			// Adding 1 for the N+1 releases when determining newest versions ourselves
-			newestMinor = newestSupportedMinor + 1
-		}
-		if oldestMinor < 0 || newestMinor < 0 || newestMinor < oldestMinor {
-			return nil, fmt.Errorf("invalid release range (%d -> %d), release versions must be non-negative and newest must be greater than oldest", oldestMinor, newestMinor)
-		}
+func generateReport(o *options) (*report, error) {
+	selector, err := parseStreamSelector(o.streams)
+	if err != nil {
+		return nil, err
 	}
+	supported, err := resolveMinorRange(o, selector)
+	if err != nil {
+		return nil, err
+	}
+	oldestMinor, newestMinor := supported.oldest, supported.newest
 
-	releaseAPIUrl, found := releaseAPIUrls[arch]
+	// the staleness limits of each minor, which may be overridden by the policy of its life-cycle phase
+	policy := func(minor int) phasePolicy {
+		return o.config.phasePolicy(supported.phases[minor])
+	}
+	acceptedStalenessLimit := func(minor int) time.Duration {
+		return policy(minor).limit(policy(minor).AcceptedStalenessLimit, o.acceptedStalenessLimit)
+	}
+	builtStalenessLimit := func(minor int) time.Duration {
+		return policy(minor).limit(policy(minor).BuiltStalenessLimit, o.builtStalenessLimit)
+	}
+	upgradeStalenessLimit := func(minor int) time.Duration {
+		return policy(minor).limit(policy(minor).UpgradeStalenessLimit, o.upgradeStalenessLimit)
+	}
+
+	releaseAPIUrl, found := releaseAPIUrls[o.arch]
 	if !found {
-		return nil, fmt.Errorf("unknown architecture: %s", arch)
+		return nil, fmt.Errorf("unknown architecture: %s", o.arch)
 	}
 	acceptedReleases, err := getReleaseStream(releaseAPIUrl + acceptedReleasePath)
 	if err != nil {
@@ -55,20 +99,52 @@ func generateReport(acceptedStalenessLimit, builtStalenessLimit, upgradeStalenes
 		return nil, err
 	}
 
-	// stable graph only includes successful edges.  nightly+prerelease include edges for any upgrade attempt that was
-	// made, regardless of whether the job passed.
-	stableGraph, err := getUpgradeGraph(releaseAPIUrl, "stable")
+	stableGraph, attemptedGraph, err := getUpgradeGraphs(releaseAPIUrl)
 	if err != nil {
 		return nil, err
 	}
 
-	report := checkUpgrades(stableGraph, allReleases, upgradeStalenessLimit, oldestMinor, newestMinor)
-	report.releaseAPIUrl = releaseAPIUrl
+	report := checkUpgrades(releaseAPIUrl, stableGraph, attemptedGraph, allReleases, upgradeStalenessLimit, o.upgradeLookback, oldestMinor, newestMinor, selector, o.config, supported.phases)
+	report.arch = o.arch
+	report.alertOnGAEdgeRemoval = o.alertOnGAEdgeRemoval
+	report.lifeCycleSource = supported.source
+	report.selector = selector
+	for _, stream := range report.streams {
+		stream.severity = o.config.phasePolicy(stream.phase).Severity
+	}
+
+	// the stable and dev-preview streams are only of interest when the selector does not pick specific z-streams
+	if o.checkReleaseCadence && !selector.restrictsStreams() {
+		checkReleaseCadence(report, o.config, releaseAPIUrl, o.arch, stableGraph, oldestMinor, newestMinor, selector, supported.phases)
+	}
+
+	if o.graphSnapshotDir != "" {
+		path := graphSnapshotPath(o.graphSnapshotDir, o.arch, "stable")
+		previous, err := loadGraphSnapshot(path)
+		if err != nil {
+			klog.Errorf("unable to load the previous upgrade graph: %v", err)
+		} else if previous != nil {
+			report.removedEdges = diffGraphSnapshots(previous.Edges, stableGraph)
+			report.previousSnapshot = previous.Taken
+		}
+		if err := saveGraphSnapshot(path, &graphSnapshot{Taken: time.Now(), Edges: stableGraph}); err != nil {
+			klog.Errorf("unable to save the upgrade graph: %v", err)
+		}
+	}
+
+	// payload ages are measured in business time when requested, so streams that went quiet over a weekend or holiday
+	// are not reported as stale
+	elapsed := o.config.Calendar.elapsedFunc(o.businessTime)
+	report.businessTime = o.businessTime && o.config.Calendar != nil
+	days := "days"
+	if report.businessTime {
+		days = "business days"
+	}
 
 	klog.V(4).Info("Checking streams for accepted payloads\n")
-	acceptedEmpty, acceptedStale := getEmptyAndStaleStreams(acceptedReleases, acceptedStalenessLimit, oldestMinor, newestMinor, releaseAPIUrl)
+	acceptedEmpty, acceptedStale := getEmptyAndStaleStreams(acceptedReleases, acceptedStalenessLimit, elapsed, oldestMinor, newestMinor, selector, supported.phases, releaseAPIUrl)
 	klog.V(4).Info("Checking streams for all payloads\n")
-	allEmpty, allStale := getEmptyAndStaleStreams(allReleases, acceptedStalenessLimit, oldestMinor, newestMinor, releaseAPIUrl)
+	allEmpty, allStale := getEmptyAndStaleStreams(allReleases, acceptedStalenessLimit, elapsed, oldestMinor, newestMinor, selector, supported.phases, releaseAPIUrl)
 
 	for stream := range acceptedEmpty {
 		klog.V(4).Infof("Examining stream %s which has no accepted payloads", stream)
@@ -76,80 +152,202 @@ func generateReport(acceptedStalenessLimit, builtStalenessLimit, upgradeStalenes
 		// (and especially if the overall payloads are not stale), flag it.  If the overall stream is empty,
 		// we'll flag it further below.
 		if _, ok := allStale[stream]; !ok {
-			report.streams[stream].unhealthyMessages = append(report.streams[stream].unhealthyMessages, "Has no accepted payloads, but the stream contains recently built payloads")
+			report.streams[stream].addUnhealthy(checkAccepted, streamMinor(stream), "Has no accepted payloads, but the stream contains recently built payloads")
 		} else if _, ok := allEmpty[stream]; !ok {
-			report.streams[stream].unhealthyMessages = append(report.streams[stream].unhealthyMessages, "Has no accepted payloads, but the stream contains built payloads")
+			report.streams[stream].addUnhealthy(checkAccepted, streamMinor(stream), "Has no accepted payloads, but the stream contains built payloads")
 		}
 
 	}
 	for stream, age := range acceptedStale {
-		report.streams[stream].unhealthyMessages = append(report.streams[stream].unhealthyMessages, fmt.Sprintf("Most recently accepted payload > %.1f days, last accepted was %.1f days ago", acceptedStalenessLimit.Hours()/24, age.Hours()/24))
+		report.streams[stream].addUnhealthy(checkAccepted, streamMinor(stream), fmt.Sprintf("Most recently accepted payload > %.1f %s, last accepted was %.1f %s ago", acceptedStalenessLimit(streamMinor(stream)).Hours()/24, days, age.Hours()/24, days))
+		if !o.includeChangelog {
+			continue
+		}
+		changelog, err := getAcceptanceChangelog(releaseAPIUrl, stream)
+		if err != nil {
+			klog.Errorf("unable to get changelog for stream %s: %v", stream, err)
+			continue
+		}
+		report.streams[stream].changelog = changelog
 	}
 
 	for stream := range allEmpty {
-		report.streams[stream].unhealthyMessages = append(report.streams[stream].unhealthyMessages, "Has no built payloads")
+		report.streams[stream].addUnhealthy(checkBuilt, streamMinor(stream), "Has no built payloads")
 	}
 
 	klog.V(4).Infof("Checking streams for very stale payloads\n")
-	_, allVeryStale := getEmptyAndStaleStreams(allReleases, builtStalenessLimit, oldestMinor, newestMinor, releaseAPIUrl)
+	_, allVeryStale := getEmptyAndStaleStreams(allReleases, builtStalenessLimit, elapsed, oldestMinor, newestMinor, selector, supported.phases, releaseAPIUrl)
 
+	classifier := newStalenessClassifier(o.arch, releaseAPIUrl, allReleases)
 	for stream, age := range allVeryStale {
-		report.streams[stream].unhealthyMessages = append(report.streams[stream].unhealthyMessages, fmt.Sprintf("Most recently built payload was %.1f days ago", age.Hours()/24))
+		evidence := classifier.classify(stream, builtStalenessLimit(streamMinor(stream)))
+		report.streams[stream].addUnhealthy(checkBuilt, streamMinor(stream), fmt.Sprintf("Most recently built payload was %.1f %s ago (%s)", age.Hours()/24, days, evidence))
 	}
 
+	report.applyFreezeWindows(o.config.Calendar, time.Now())
 	return report, nil
 }
 
-func (rep *report) String(includeHealthy bool) string {
+// addUnhealthy records an unhealthy finding of the given check about a minor, -1 if it is not about a single minor
+func (r *releaseReport) addUnhealthy(check string, minor int, msg string) {
+	r.unhealthyMessages = append(r.unhealthyMessages, msg)
+	r.unhealthyChecks = append(r.unhealthyChecks, check)
+	r.unhealthyMinors = append(r.unhealthyMinors, minor)
+}
+
+// streamMinor returns the minor version of a z-stream, or -1 if the stream is not a z-stream, such as 4-stable, which
+// spans every minor
+func streamMinor(stream string) int {
+	matches := zReleaseRegex.FindStringSubmatch(stream)
+	if matches == nil {
+		return -1
+	}
+	v, _ := strconv.Atoi(matches[1])
+	return v
+}
+
+// unhealthyCounts returns the number of unhealthy streams, and how many of those only have low severity findings
+func (rep *report) unhealthyCounts() (int, int) {
+	unhealthy, low := 0, 0
+	for _, stream := range rep.streams {
+		if len(stream.unhealthyMessages) == 0 {
+			continue
+		}
+		unhealthy++
+		if stream.severity == severityLow {
+			low++
+		}
+	}
+	return unhealthy, low
+}
+
+// sortedStreams returns the streams in the report ordered from the newest to the oldest minor
+func (rep *report) sortedStreams() []string {
 	streams := []string{}
 	for stream := range rep.streams {
 		streams = append(streams, stream)
 	}
 
+	// streams that span every minor, such as 4-stable, are not tied to a version and are listed first
+	version := func(stream string) int {
+		matches := extractMinorRegex.FindStringSubmatch(stream)
+		if matches == nil {
+			return math.MaxInt32
+		}
+		v, _ := strconv.Atoi(matches[1])
+		return v
+	}
 	sort.Strings(streams)
-	sort.Slice(streams, func(i, j int) bool {
-		iMatches := extractMinorRegex.FindStringSubmatch(streams[i])
-		iVersion, _ := strconv.Atoi(iMatches[1])
-		jMatches := extractMinorRegex.FindStringSubmatch(streams[j])
-		jVersion, _ := strconv.Atoi(jMatches[1])
+	sort.SliceStable(streams, func(i, j int) bool {
 		// this deliberately reverses the standard sorting order so we
 		// get highest to lowest.
-		return iVersion > jVersion
+		return version(streams[i]) > version(streams[j])
 
 	})
+	return streams
+}
 
+func (rep *report) String(includeHealthy bool) string {
 	output := ""
+	for _, stream := range rep.listedStreams(includeHealthy) {
+		output += rep.streamString(stream, includeHealthy)
+	}
+	if !includeHealthy && len(output) == 0 {
+		output += "No unhealthy payload streams detected\n"
+	}
+	return rep.headerString() + output + rep.footerString()
+}
 
-	for _, stream := range streams {
+// listedStreams returns the streams the report lists, in order
+func (rep *report) listedStreams(includeHealthy bool) []string {
+	streams := []string{}
+	for _, stream := range rep.sortedStreams() {
 		if len(rep.streams[stream].unhealthyMessages) == 0 && !includeHealthy {
 			continue // nothing to say about this healthy stream
 		}
+		streams = append(streams, stream)
+	}
+	return streams
+}
 
+// headerString describes where the supported releases came from and how payload ages were measured
+func (rep *report) headerString() string {
+	header := ""
+	if rep.lifeCycleSource != nil {
+		header = fmt.Sprintf("Supported releases from %s\n\n", rep.lifeCycleSource)
+	}
+	if rep.businessTime {
+		header += "Payload ages are measured in business time\n\n"
+	}
+	if rep.selector != nil {
+		header += fmt.Sprintf("Only streams selected by %q are reported on\n\n", rep.selector)
+	}
+	return header
+}
+
+// streamString lists the findings of a single stream, followed by a blank line
+func (rep *report) streamString(stream string, includeHealthy bool) string {
+	output := ""
+	if phase := rep.streams[stream].phase; phase != "" {
+		output += fmt.Sprintf("%s/#%s (%s)\n", rep.releaseAPIUrl, stream, phase)
+	} else {
 		output += fmt.Sprintf("%s/#%s\n", rep.releaseAPIUrl, stream)
+	}
 
-		unhealthyPrefix := ""
-		if includeHealthy {
-			unhealthyPrefix = "*WARNING:* "
-		}
-		for _, o := range rep.streams[stream].unhealthyMessages {
-			output += fmt.Sprintf("  * %s%s\n", unhealthyPrefix, o)
-		}
+	unhealthyPrefix := ""
+	if includeHealthy {
+		unhealthyPrefix = "*WARNING:* "
+	}
+	if rep.streams[stream].severity == severityLow {
+		unhealthyPrefix += "(low severity) "
+	}
+	for i, o := range rep.streams[stream].unhealthyMessages {
+		output += fmt.Sprintf("  * %s%s%s\n", unhealthyPrefix, o, rep.streams[stream].mention(i))
+	}
+	if rep.streams[stream].changelog != nil {
+		output += fmt.Sprintf("  * %s\n", rep.streams[stream].changelog.summary())
+	}
+	if escalation := rep.streams[stream].escalation; escalation != "" {
+		output += fmt.Sprintf("  * %s\n", escalation)
+	}
 
-		if includeHealthy {
-			for _, o := range rep.streams[stream].healthyMessages {
-				output += fmt.Sprintf("  * %s\n", o)
-			}
+	if includeHealthy {
+		for _, o := range rep.streams[stream].healthyMessages {
+			output += fmt.Sprintf("  * %s\n", o)
 		}
+	}
 
-		output += "\n"
+	return output + "\n"
+}
+
+// footerString lists the removed upgrade edges, the freeze window notes and the ignored range
+func (rep *report) footerString() string {
+	output := ""
+	if removed := rep.removedEdgesString(); removed != "" {
+		output += "\n" + removed
 	}
-	if !includeHealthy && len(output) == 0 {
-		output += "No unhealthy payload streams detected\n"
+	for _, note := range rep.freezeNotes {
+		output += fmt.Sprintf("\nNote: %s", note)
+	}
+	if len(rep.freezeNotes) > 0 {
+		output += "\n"
 	}
 	output += fmt.Sprintf("\nIgnored releases older than 4.%d.z and newer than 4.%d.z\n", rep.oldestMinor, rep.newestMinor)
 	return output
 }
 
+// changelogDetails lists the full changelog for every stream with stale acceptance
+func (rep *report) changelogDetails() string {
+	output := ""
+	for _, stream := range rep.sortedStreams() {
+		if rep.streams[stream].changelog == nil {
+			continue
+		}
+		output += fmt.Sprintf("%s/#%s\n%s\n", rep.releaseAPIUrl, stream, rep.streams[stream].changelog.details())
+	}
+	return output
+}
+
 func getReleaseStream(url string) (map[string][]string, error) {
 	res, err := http.Get(url)
 	if err != nil {
@@ -171,7 +369,10 @@ func getReleaseStream(url string) (map[string][]string, error) {
 	return releases, nil
 }
 
-func getEmptyAndStaleStreams(releases map[string][]string, threshold time.Duration, oldestMinor, newestMinor int, releaseAPIUrl string) (map[string]struct{}, map[string]time.Duration) {
+// getEmptyAndStaleStreams returns the streams without payloads, and the streams whose newest payload is older than
+// the threshold of their minor along with its age.  Ages are measured with elapsed, and only the streams the selector
+// selects are considered.
+func getEmptyAndStaleStreams(releases map[string][]string, thresholdFor func(minor int) time.Duration, elapsed func(from, to time.Time) time.Duration, oldestMinor, newestMinor int, selector *streamSelector, phases map[int]string, releaseAPIUrl string) (map[string]struct{}, map[string]time.Duration) {
 	emptyStreams := make(map[string]struct{})
 	staleStreams := make(map[string]time.Duration)
 	releaseKeys := reflect.ValueOf(releases).MapKeys()
@@ -193,6 +394,11 @@ func getEmptyAndStaleStreams(releases map[string][]string, threshold time.Durati
 			klog.V(4).Infof("ignoring release %s because it is newer than the newest desired minor %d\n", stream, newestMinor)
 			continue
 		}
+		if !selector.matches(stream, phases) {
+			klog.V(4).Infof("ignoring release %s because it is not selected by %s\n", stream, selector)
+			continue
+		}
+		threshold := thresholdFor(streamMinor(stream))
 		if len(releases[stream]) == 0 {
 			klog.V(4).Infof("Release %s has no payloads\n", stream)
 			emptyStreams[stream] = struct{}{}
@@ -206,7 +412,7 @@ func getEmptyAndStaleStreams(releases map[string][]string, threshold time.Durati
 				klog.Errorf("unable to get payload timestamp: %v", err)
 				continue
 			}
-			delta := now.Sub(ts)
+			delta := elapsed(ts, now)
 			if delta.Minutes() < threshold.Minutes() {
 				klog.V(4).Infof("Release %s in stream %s is fresh: %0.1f hours old (threshold is %0.1f)\n", payload, stream, delta.Hours(), threshold.Hours())
 				freshPayload = true
@@ -219,7 +425,7 @@ func getEmptyAndStaleStreams(releases map[string][]string, threshold time.Durati
 		}
 		if !freshPayload {
 			klog.V(4).Infof("Release stream %s does not have a recent payload: "+releaseAPIUrl+"/#"+stream+"\n", stream)
-			staleStreams[stream] = now.Sub(newest)
+			staleStreams[stream] = elapsed(newest, now)
 		}
 	}
 	return emptyStreams, staleStreams
@@ -256,24 +462,33 @@ type Graph struct {
 
 type GraphMap map[string][]string
 
-func getUpgradeGraph(apiurl, channel string) (GraphMap, error) {
-	graphMap := GraphMap{}
-
-	graph := Graph{}
+// getGraph fetches the full upgrade graph of a channel from the release controller
+func getGraph(apiurl, channel string) (*Graph, error) {
+	graph := &Graph{}
 	url := apiurl + "/graph?channel=" + channel
 	res, err := http.Get(url)
 	if err != nil {
-		return graphMap, fmt.Errorf("error fetching upgrade graph from %s: %s", url, err)
+		return nil, fmt.Errorf("error fetching upgrade graph from %s: %s", url, err)
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return graphMap, fmt.Errorf("non-OK http response code fetching upgrade graph from %s: %d", url, res.StatusCode)
+		return nil, fmt.Errorf("non-OK http response code fetching upgrade graph from %s: %d", url, res.StatusCode)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(graph)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding upgrade graph: %v", err)
 	}
+	return graph, nil
+}
+
+func getUpgradeGraph(apiurl, channel string) (GraphMap, error) {
+	graphMap := GraphMap{}
 
-	err = json.NewDecoder(res.Body).Decode(&graph)
+	graph, err := getGraph(apiurl, channel)
 	if err != nil {
-		return graphMap, fmt.Errorf("error decoding upgrade graph: %v", err)
+		return graphMap, err
 	}
 
 	for _, edge := range graph.Edges {
@@ -292,20 +507,66 @@ func getUpgradeGraph(apiurl, channel string) (GraphMap, error) {
 
 type found struct {
 	Version string
-	Age     time.Duration
+	// how long ago the upgrade job ran
+	Age time.Duration
+	// link to the upgrade job, if known
+	URL string
 }
 
 func (f *found) Days() float64 {
 	return f.Age.Hours() / 24
 }
 
-func checkUpgrades(graph GraphMap, releases map[string][]string, stalenessThreshold time.Duration, oldestMinor, newestMinor int) *report {
+func (f *found) String() string {
+	if f.URL == "" {
+		return fmt.Sprintf("from %s, upgrade job ran %0.1f days ago", f.Version, f.Days())
+	}
+	return fmt.Sprintf("from %s, upgrade job ran %0.1f days ago: %s", f.Version, f.Days(), f.URL)
+}
+
+// upgradeAttempts tracks the recent upgrade attempts of a single level (patch or minor) into a release stream
+type upgradeAttempts struct {
+	attempted  int
+	failed     int
+	failedFrom map[string]struct{}
+}
+
+func (a *upgradeAttempts) record(from string, succeeded bool) {
+	a.attempted++
+	if succeeded {
+		return
+	}
+	a.failed++
+	if a.failedFrom == nil {
+		a.failedFrom = make(map[string]struct{})
+	}
+	a.failedFrom[from] = struct{}{}
+}
+
+func (a *upgradeAttempts) String() string {
+	if a.attempted == 0 {
+		return "no upgrade was attempted recently"
+	}
+	froms := []string{}
+	for from := range a.failedFrom {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	if len(froms) == 0 {
+		return fmt.Sprintf("%d recent attempts, none failed", a.attempted)
+	}
+	return fmt.Sprintf("%d of %d recent attempts failed, from %s", a.failed, a.attempted, strings.Join(froms, ", "))
+}
+
+func checkUpgrades(releaseAPIUrl string, graph, attemptedGraph GraphMap, releases map[string][]string, stalenessThreshold func(minor int) time.Duration, lookback time.Duration, oldestMinor, newestMinor int, selector *streamSelector, cfg *config, phases map[int]string) *report {
 	rep := &report{
-		streams:     make(map[string]*releaseReport, len(releases)),
-		oldestMinor: oldestMinor,
-		newestMinor: newestMinor,
+		streams:       make(map[string]*releaseReport, len(releases)),
+		oldestMinor:   oldestMinor,
+		newestMinor:   newestMinor,
+		releaseAPIUrl: releaseAPIUrl,
 	}
 
+	latestGA := latestGAVersions(graph)
 	now := time.Now()
 	for release, payloads := range releases {
 
@@ -324,66 +585,91 @@ func checkUpgrades(graph GraphMap, releases map[string][]string, stalenessThresh
 			klog.V(4).Infof("ignoring release %s because it is newer than the newest desired minor %d\n", release, newestMinor)
 			continue
 		}
+		if !selector.matches(release, phases) {
+			klog.V(4).Infof("ignoring release %s because it is not selected by %s\n", release, selector)
+			continue
+		}
 
-		var foundMinor *found
-		var foundPatch *found
-		rep.streams[release] = &releaseReport{}
-		for _, payload := range payloads {
-			ts, err := getPayloadTimestamp(payload)
-			if err != nil {
-				klog.Error(err.Error())
+		rep.streams[release] = &releaseReport{phase: phases[v]}
+		statuses := []*upgradePathStatus{}
+		for i := range cfg.UpgradePaths {
+			path := &cfg.UpgradePaths[i]
+			if !path.appliesTo(release, v, phases[v]) {
 				continue
 			}
-			age := now.Sub(ts)
-			if age.Minutes() > stalenessThreshold.Minutes() {
+			if cfg.phasePolicy(phases[v]).skips(path) {
+				rep.streams[release].healthyMessages = append(rep.streams[release].healthyMessages, fmt.Sprintf("Does not require a %s upgrade while in %s", path.Name, phases[v]))
 				continue
 			}
+			status := &upgradePathStatus{path: path, attempts: &upgradeAttempts{}}
+			if path.From == upgradeFromLatestGA {
+				status.source = latestGA[v-path.MinorOffset]
+				if status.source == "" {
+					klog.V(4).Infof("not requiring the %s upgrade path for %s because 4.%d has no generally available release\n", path.Name, release, v-path.MinorOffset)
+					rep.streams[release].healthyMessages = append(rep.streams[release].healthyMessages, fmt.Sprintf("Does not require a %s upgrade because 4.%d has no generally available release yet", path.Name, v-path.MinorOffset))
+					continue
+				}
+			}
+			statuses = append(statuses, status)
+		}
+
+		for _, payload := range payloads {
 			toMatches := extractMinorRegex.FindStringSubmatch(payload)
 			if toMatches == nil {
 				continue
 			}
 			toVersion, _ := strconv.Atoi(toMatches[1])
+			ts, err := getPayloadTimestamp(payload)
+			if err != nil {
+				klog.Error(err.Error())
+				continue
+			}
+			// only the payloads within the lookback have their upgrade results fetched
+			if now.Sub(ts) > lookback {
+				continue
+			}
 
-			for _, from := range graph[payload] {
-
-				fromMatches := extractMinorRegex.FindStringSubmatch(from)
-
+			for _, result := range getUpgradeResults(releaseAPIUrl, release, payload, graph, attemptedGraph) {
+				age := now.Sub(result.ran)
+				fromMatches := extractMinorRegex.FindStringSubmatch(result.from)
 				if fromMatches == nil {
-					klog.V(4).Infof("Ignoring upgrade to %s from %s because the minor version could not be determined\n", payload, from)
+					klog.V(4).Infof("Ignoring upgrade to %s from %s because the minor version could not be determined\n", payload, result.from)
 					continue
 				}
 				fromVersion, _ := strconv.Atoi(fromMatches[1])
 
-				klog.V(4).Infof("Payload %s successfully upgrades from %s\n", payload, from)
-				if toVersion == fromVersion {
-					foundPatch = &found{
-						Version: from,
-						Age:     age,
+				for _, status := range statuses {
+					if toVersion-status.path.MinorOffset != fromVersion {
+						continue
 					}
-				}
-				if toVersion == fromVersion+1 {
-					foundMinor = &found{
-						Version: from,
-						Age:     age,
+					if status.source != "" && status.source != result.from {
+						continue
+					}
+					if age.Minutes() > status.path.freshness(stalenessThreshold(v)).Minutes() {
+						continue
+					}
+					status.attempts.record(result.from, result.succeeded)
+					if !result.succeeded {
+						continue
+					}
+					klog.V(4).Infof("Payload %s successfully upgraded from %s %0.1f hours ago\n", payload, result.from, age.Hours())
+					if status.found == nil || age < status.found.Age {
+						status.found = &found{
+							Version: result.from,
+							Age:     age,
+							URL:     result.url,
+						}
 					}
-				}
-				if foundMinor != nil && foundPatch != nil {
-					// we have found a recent payload in the set of payloads this release, which successfully upgraded from a previous minor
-					// and a previous patch, so we don't need to continue checking payloads for this release.
-					break
 				}
 			}
 		}
 
-		if foundPatch == nil {
-			rep.streams[release].unhealthyMessages = append(rep.streams[release].unhealthyMessages, "Does not have a recent valid patch level upgrade")
-		} else {
-			rep.streams[release].healthyMessages = append(rep.streams[release].healthyMessages, fmt.Sprintf("Has a recent valid patch level upgrade from %s %0.1f days ago", foundPatch.Version, foundPatch.Days()))
-		}
-		if foundMinor == nil {
-			rep.streams[release].unhealthyMessages = append(rep.streams[release].unhealthyMessages, "Does not have a recent valid minor level upgrade")
-		} else {
-			rep.streams[release].healthyMessages = append(rep.streams[release].healthyMessages, fmt.Sprintf("Has a recent valid minor level upgrade from %s %0.1f days ago", foundMinor.Version, foundMinor.Days()))
+		for _, status := range statuses {
+			if status.found == nil {
+				rep.streams[release].addUnhealthy(checkUpgrade, v, fmt.Sprintf("Does not have a recent valid %s (%s)", status.description(v), status.attempts))
+			} else {
+				rep.streams[release].healthyMessages = append(rep.streams[release].healthyMessages, fmt.Sprintf("Has a recent valid %s %s (%s)", status.description(v), status.found, status.attempts))
+			}
 		}
 	}
 	return rep
@@ -1,30 +1,36 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"k8s.io/klog"
 )
 
+const (
+	// the reaction marking an event while its command runs
+	workingReaction = "hourglass_flowing_sand"
+	// how many times Slack retries an event that was not acknowledged
+	slackEventRetries = 3
+)
+
 var (
-	mutex          = &sync.Mutex{}
-	msgCache       = make(map[string]struct{})
-	authToken      string
 	patchManagerId = "SMZ7PJ1L0"
 )
 
 type Request struct {
-	Token string `json:"token"`
-	Type  string `json:"type"`
+	Token   string `json:"token"`
+	Type    string `json:"type"`
+	EventID string `json:"event_id"`
 
 	// challenge request fields
 	Challenge string `json:"challenge"`
@@ -35,10 +41,40 @@ type Request struct {
 
 type Event struct {
 	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
 	Text    string `json:"text"`
 	User    string `json:"user"`
+	BotID   string `json:"bot_id"`
 	Channel string `json:"channel"`
-	TS      string `json:"ts"`
+	// ChannelType is "im" for direct messages
+	ChannelType string `json:"channel_type"`
+	TS          string `json:"ts"`
+	// Message is the message as edited, for message_changed events
+	Message *Event `json:"message"`
+	// Edited is set on messages a user edited, as opposed to messages Slack changed, e.g. to unfurl a link
+	Edited *struct {
+		User string `json:"user"`
+		TS   string `json:"ts"`
+	} `json:"edited"`
+}
+
+// Interaction is the payload Slack sends when a user clicks a button in one of the bot's messages
+type Interaction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	Message struct {
+		TS       string `json:"ts"`
+		ThreadTS string `json:"thread_ts"`
+	} `json:"message"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
 }
 
 type VerificationResponse struct {
@@ -50,6 +86,9 @@ type PostMessage struct {
 	Channel  string `json:"channel"`
 	Text     string `json:"text"`
 	ThreadTS string `json:"thread_ts,omitempty"`
+	// Blocks and Attachments are the rich form of the message, Text is then only shown in notifications
+	Blocks      []slackBlock      `json:"blocks,omitempty"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
 }
 
 type PostMessageResponse struct {
@@ -57,7 +96,31 @@ type PostMessageResponse struct {
 }
 
 func (o *options) serve() {
-	authToken = os.Getenv("TOKEN")
+	o.slack = newSlackClient(o.slackAPIUrl, os.Getenv("TOKEN"), o.slackTimeout, o.slackRetries)
+	o.slackSigningSecret = os.Getenv("SIGNING_SECRET")
+	if o.slackSigningSecret == "" {
+		log.Fatal("SIGNING_SECRET must be set to the signing secret of the Slack app")
+	}
+	// the bot must recognize its own messages, so it never responds to itself
+	if err := o.slack.identify(); err != nil {
+		log.Fatal("unable to identify the bot user: ", err)
+	}
+	o.resolveGroups()
+	if len(o.config.Escalations) > 0 {
+		state, err := loadEscalationState(o.escalationStateFile)
+		if err != nil {
+			log.Fatal("unable to load the escalation state: ", err)
+		}
+		o.escalations = state
+	}
+	o.seenEvents = newEventCache(o.eventDedupeTTL)
+	o.events = make(chan Event, o.eventQueueSize)
+	for i := 0; i < o.eventWorkers; i++ {
+		go o.processEvents()
+	}
+	if o.escalations != nil && o.escalationInterval > 0 {
+		go o.evaluateEscalations(o.escalationInterval)
+	}
 	http.HandleFunc("/", o.createHandler())  // set router
 	err := http.ListenAndServe(":8080", nil) // set listen port
 	if err != nil {
@@ -73,6 +136,17 @@ func (o *options) createHandler() http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		// only Slack knows the signing secret, so anything else posting to us is turned away before it is acted on
+		if err := verifySlackSignature(r.Header, body, o.slackSigningSecret, time.Now()); err != nil {
+			klog.Errorf("rejecting unverified request from %s: %v", r.RemoteAddr, err)
+			http.Error(w, "invalid request signature", http.StatusUnauthorized)
+			return
+		}
+		// interactive components, such as the acknowledge buttons, post their payload as a form field rather than json
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			o.handleInteraction(w, body)
+			return
+		}
 		req := Request{}
 		if err := json.Unmarshal([]byte(body), &req); err != nil {
 			fmt.Printf("error: %v\n", err)
@@ -91,164 +165,202 @@ func (o *options) createHandler() http.HandlerFunc {
 		}
 
 		if req.Type == "event_callback" {
+			event, ok := o.slack.commandEvent(req.Event)
+			if !ok {
+				klog.V(4).Infof("ignoring event that is not a command: %#v\n", req.Event)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			req.Event = event
 
-			mutex.Lock()
-			if _, found := msgCache[req.Event.TS]; found {
-				klog.V(4).Infof("ignoring dupe event: %#v\n", req.Event)
+			// Slack gives up on a request after three seconds, so events are only queued here and processed by the
+			// workers.  A retry of an event that was already queued is acknowledged without queueing it again.
+			id := req.EventID
+			if id == "" {
+				id = req.Event.TS
+			}
+			if !o.seenEvents.add(id, time.Now()) {
+				klog.V(4).Infof("ignoring dupe event %s (retry %s): %#v\n", id, r.Header.Get("X-Slack-Retry-Num"), req.Event)
 				w.WriteHeader(http.StatusOK)
-				mutex.Unlock()
 				return
 			}
-			msgCache[req.Event.TS] = struct{}{}
-			mutex.Unlock()
-			klog.V(4).Infof("saw message event: %#v\n", req.Event)
-
-			subject := ""
-			msg := ""
-			thread := req.Event.TS
-			switch {
-			case strings.Contains(req.Event.Text, "help"):
-				subject = fmt.Sprintf(`*help* - this help text
-*report* - Generates human reports about which release streams do not have recently built or recently accepted payloads, based on the release info found at https://amd64.ocp.releases.ci.openshift.org/ or the equivalent page for the architecture specified in the request.
-Arguments:
-  *min=X* - only look at z-streams with a minimum version of X, e.g. *min=9*
-  *max=X* - only look at z-streams with a maximum version of X, e.g. *max=12*
-  *arch=X* - look at architecture X, where X is one of [*amd64*, *multi*, *arm64*, *ppc64le*, *s390x*]
-  *healthy* - include healthy z-streams in the report
-  *tag* - tag patch manager with the report output
-Current settings/defaults:
-  Accepted payloads must be newer than *%0.1f* hours
-  Payloads must have been built within the last *%0.1f* hours
-  Default: Included releases are >=*4.%d* and <=*4.%d*
-  Default: Architecture is *%s*
-  Default: Fully healthy z-streams are not included in the report`, o.acceptedStalenessLimit.Hours(), o.builtStalenessLimit.Hours(), o.oldestMinor, o.newestMinor, o.arch)
-			case strings.Contains(req.Event.Text, "report"):
-				reportOptions := *o
-				reportOptions.includeHealthy = false
-				tagPatchManager := false
-
-				args := strings.Split(req.Event.Text, " ")
-				for _, arg := range args {
-					if arg == "tag" {
-						tagPatchManager = true
-					}
-
-					if arg == "healthy" {
-						reportOptions.includeHealthy = true
-					}
-					if strings.Contains(arg, "=") {
-						v := strings.Split(arg, "=")
-						switch v[0] {
-						case "min":
-							i, err := strconv.Atoi(v[1])
-							if err != nil {
-								err = fmt.Errorf("error parsing min z-stream version value %q: %w", v[1], err)
-								_, _ = sendMessage(err.Error(), req.Event.Channel, thread)
-								http.Error(w, err.Error(), http.StatusInternalServerError)
-								return
-							}
-							reportOptions.oldestMinor = i
-
-						case "max":
-							i, err := strconv.Atoi(v[1])
-							if err != nil {
-								err = fmt.Errorf("error parsing max z-stream version value %q: %w", v[1], err)
-								_, _ = sendMessage(err.Error(), req.Event.Channel, thread)
-								http.Error(w, err.Error(), http.StatusInternalServerError)
-								return
-							}
-							reportOptions.newestMinor = i
-						case "arch":
-							reportOptions.arch = v[1]
+			select {
+			case o.events <- req.Event:
+				klog.V(4).Infof("queued event %s: %#v\n", id, req.Event)
+				w.WriteHeader(http.StatusOK)
+			default:
+				// Slack retries an event three times, so unless this was the last retry forget the event and ask for
+				// another retry, which is queued if there is room by then
+				if retry, _ := strconv.Atoi(r.Header.Get("X-Slack-Retry-Num")); retry >= slackEventRetries {
+					klog.Errorf("event queue is full, dropping event %s after its last retry", id)
+					go func(event Event) {
+						if _, err := o.slack.sendMessage("Sorry, I'm too busy to handle that request right now, please try again later", event.Channel, event.TS); err != nil {
+							klog.Errorf("unable to report the dropped event: %v", err)
 						}
-					}
-
+					}(req.Event)
+					w.WriteHeader(http.StatusOK)
+					return
 				}
+				o.seenEvents.remove(id)
+				klog.Errorf("event queue is full, asking slack to retry event %s", id)
+				http.Error(w, "event queue is full", http.StatusServiceUnavailable)
+			}
+		}
+	}
+}
 
-				rep, err := generateReport(reportOptions.acceptedStalenessLimit, reportOptions.builtStalenessLimit, reportOptions.upgradeStalenessLimit, reportOptions.oldestMinor, reportOptions.newestMinor, reportOptions.arch)
-				if err != nil {
-					subject = fmt.Sprintf("Sorry, an error occurred generating the report: %v", err)
-				} else {
-					numUnhealthy := 0
-					for _, stream := range rep.streams {
-						if len(stream.unhealthyMessages) > 0 {
-							numUnhealthy += 1
-						}
+// handleInteraction queues the clicks of acknowledge buttons as ack commands, answered in the thread of the message
+// holding the button.  Other buttons, such as those opening release pages, need no handling.
+func (o *options) handleInteraction(w http.ResponseWriter, body []byte) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	interaction := Interaction{}
+	if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, action := range interaction.Actions {
+		if !strings.HasPrefix(action.ActionID, ackActionPrefix) {
+			continue
+		}
+		thread := interaction.Message.ThreadTS
+		if thread == "" {
+			thread = interaction.Message.TS
+		}
+		event := Event{Type: interaction.Type, Text: "ack " + action.Value, User: interaction.User.ID, Channel: interaction.Channel.ID, TS: thread}
+		select {
+		case o.events <- event:
+			klog.V(4).Infof("queued interaction: %#v\n", event)
+		default:
+			klog.Errorf("event queue is full, dropping interaction %#v", event)
+			http.Error(w, "event queue is full", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
 
-					}
-					subject = fmt.Sprintf("Latest payload stream health report thread for `%s`, `v4.%d` to `v4.%d` (%d of %d streams unhealthy)", reportOptions.arch, rep.oldestMinor, rep.newestMinor, numUnhealthy, len(rep.streams))
-					msg = rep.String(reportOptions.includeHealthy)
-				}
-				if tagPatchManager {
-					if reportOptions.includeHealthy {
-						msg = fmt.Sprintf("<!subteam^%s> here is the latest payload health report\n\n%s", patchManagerId, msg)
-					} else {
-						msg = fmt.Sprintf("<!subteam^%s> here are the currently unhealthy payload streams that need investigation:\n\n%s", patchManagerId, msg)
-					}
-				}
+// processEvents is run by each worker, handling queued events one at a time
+func (o *options) processEvents() {
+	for event := range o.events {
+		if err := o.handleEvent(event); err != nil {
+			klog.Errorf("error handling event %#v: %v", event, err)
+		}
+	}
+}
 
-			default:
-				subject = fmt.Sprintf("Sorry, I couldn't process that request: %s", req.Event.Text)
+// handleEvent runs the command in an event and posts its output into a thread.  The event is marked with a reaction
+// while the command runs, since reports can take a while to generate.
+func (o *options) handleEvent(event Event) error {
+	klog.V(4).Infof("saw message event: %#v\n", event)
+	if err := o.slack.addReaction(event.Channel, event.TS, workingReaction); err != nil {
+		klog.Errorf("unable to mark the event as being worked on: %v", err)
+	} else {
+		defer func() {
+			if err := o.slack.removeReaction(event.Channel, event.TS, workingReaction); err != nil {
+				klog.Errorf("unable to unmark the event as being worked on: %v", err)
 			}
+		}()
+	}
 
-			ts, err := sendMessage(subject, req.Event.Channel, thread)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			if msg != "" {
-				_, err = sendMessage(msg, req.Event.Channel, ts)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-				} else {
-					w.WriteHeader(http.StatusOK)
-				}
-			}
+	var reply *botReply
+	command, opts, req, err := o.parseCommand(event.Text)
+	if err != nil {
+		reply = &botReply{subject: fmt.Sprintf("Sorry, I couldn't process that request: %v", err)}
+	} else {
+		req.requester = event.User
+		reply = command.run(opts, req)
+	}
+
+	ts, err := o.slack.sendMessage(reply.subject, event.Channel, event.TS)
+	if err != nil {
+		return err
+	}
+	// long output is split over several replies, or uploaded as a file into the thread when it is too long to read as
+	// replies
+	if reply.pages != nil {
+		err = o.slack.sendReportPages(reply.pages, reply.msg, "The report is too long to post as replies, here it is as a file", event.Channel, ts)
+	} else if reply.msg != "" {
+		err = o.slack.sendLongMessage(reply.msg, "The output is too long to post as replies, here it is as a file", event.Channel, ts)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to post the reply: %w", err)
+	}
+	if reply.details != "" {
+		err = o.slack.sendLongMessage(reply.details, "The changes are too long to post as replies, here they are as a file", event.Channel, ts)
+		if err != nil {
+			return fmt.Errorf("unable to post the changes: %w", err)
 		}
 	}
+	o.sendNotices(reply.notices)
+	return nil
 }
 
-func sendMessage(msg, channel, thread string) (string, error) {
+func (c *slackClient) sendMessage(msg, channel, thread string) (string, error) {
 	post := PostMessage{}
 	post.Channel = channel
-	// never output our own name, so we don't trigger ourselves
-	//fmt.Printf("original response: %s\n", msg.Text)
-	post.Text = strings.Replace(msg, "@UE23Q9BFY", "OCP Payload Reporter", -1)
-	//fmt.Printf("replaced response: %s\n", msg.Text)
+	post.Text = msg
 
 	if thread != "" {
 		post.ThreadTS = thread
 	}
 
-	postJson, _ := json.Marshal(post)
+	return c.postMessage(&post)
+}
 
-	fmt.Printf("msg post json: %s\n", postJson)
-	req, err := http.NewRequest("POST", "https://slack.com/api/chat.postMessage", bytes.NewBuffer(postJson))
-	if err != nil {
-		fmt.Printf("error generating request: %v", err)
-		return "", err
+// sendRichMessage posts the Block Kit form of a message, with text as the notification fallback.  If Slack rejects
+// the blocks, text is posted on its own instead.
+func (c *slackClient) sendRichMessage(rich *slackMessage, text, channel, thread string) (string, error) {
+	post := PostMessage{
+		Channel:     channel,
+		Text:        text,
+		ThreadTS:    thread,
+		Blocks:      rich.Blocks,
+		Attachments: rich.Attachments,
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authToken))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("error posting chat message: %v", err)
-		return "", err
+	ts, err := c.postMessage(&post)
+	var apiErr *slackAPIError
+	if errors.As(err, &apiErr) {
+		if _, rejected := blockRejectionErrors[apiErr.Code]; rejected {
+			klog.Errorf("slack rejected the blocks of a message (%s), posting it as text", apiErr.Code)
+			return c.sendMessage(text, channel, thread)
+		}
 	}
-	defer resp.Body.Close()
-	// fmt.Printf("chat message response: %#v\n", resp)
+	return ts, err
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("error reading message response body: %v\n", err)
-		return "", err
+// evaluateEscalations reports on the bot's own settings every interval and records the findings in the escalation
+// state, so streams keep escalating while nobody runs the report command.  The report is not posted, only the notices
+// of the levels it reaches are sent.
+func (o *options) evaluateEscalations(interval time.Duration) {
+	opts := *o
+	// the snapshot of the upgrade graph is left to the reports people read, which would otherwise miss the edges
+	// removed since the last evaluation, and the changelog is not needed to tell whether a stream is healthy
+	opts.graphSnapshotDir = ""
+	opts.includeChangelog = false
+	for range time.Tick(interval) {
+		rep, err := generateReport(&opts)
+		if err != nil {
+			klog.Errorf("unable to generate the report to evaluate the escalations: %v", err)
+			continue
+		}
+		now := time.Now()
+		notices, _, err := o.escalations.update(rep, o.config.Escalations, now, !o.config.QuietHours.active(now), o.groupMention)
+		if err != nil {
+			klog.Errorf("unable to save the escalation state: %v", err)
+		}
+		o.sendNotices(notices)
 	}
-	msgResp := PostMessageResponse{}
-	if err := json.Unmarshal(body, &msgResp); err != nil {
-		fmt.Printf("error reading message response body: %v\n", err)
-		return "", err
+}
+
+// sendNotices sends the escalation notices to their channels, outside of any thread
+func (o *options) sendNotices(notices []escalationNotice) {
+	for _, notice := range notices {
+		if _, err := o.slack.sendRichMessage(notice.rich, notice.text, notice.channel, ""); err != nil {
+			klog.Errorf("unable to send the escalation notice to %s: %v", notice.channel, err)
+		}
 	}
-	return msgResp.TS, nil
 }
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// Slack rejects the whole message when a section's text is longer than slackSectionLimit, or a header's text is
+	// longer than slackHeaderLimit
+	slackSectionLimit = 3000
+	slackHeaderLimit  = 150
+	// Slack rejects messages with more blocks than this, including the blocks inside attachments
+	slackBlocksPerMessage = 50
+	// Slack rejects context blocks with more elements than this
+	slackContextElements = 10
+
+	colorHealthy      = "#2eb67d"
+	colorLowSeverity  = "#ecb22e"
+	colorHighSeverity = "#e01e5a"
+)
+
+var (
+	// the errors with which Slack rejects a message because of its blocks or attachments, rather than its text
+	blockRejectionErrors = map[string]struct{}{
+		"invalid_blocks":        {},
+		"invalid_blocks_format": {},
+		"invalid_attachments":   {},
+		"too_many_attachments":  {},
+		"msg_blocks_too_long":   {},
+	}
+)
+
+// slackText is a Block Kit text object, either "plain_text" or "mrkdwn"
+type slackText struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Emoji bool   `json:"emoji,omitempty"`
+}
+
+// slackButton is a Block Kit button element, which either opens URL or sends Value back to the bot as ActionID
+type slackButton struct {
+	Type     string    `json:"type"`
+	Text     slackText `json:"text"`
+	ActionID string    `json:"action_id"`
+	URL      string    `json:"url,omitempty"`
+	Value    string    `json:"value,omitempty"`
+	Style    string    `json:"style,omitempty"`
+}
+
+// slackBlock is a Block Kit layout block.  Only the fields used by the blocks the bot sends are modeled: header and
+// section blocks use Text, sections may carry a button as their Accessory, context blocks hold text objects as their
+// Elements and actions blocks hold buttons.
+type slackBlock struct {
+	Type      string        `json:"type"`
+	BlockID   string        `json:"block_id,omitempty"`
+	Text      *slackText    `json:"text,omitempty"`
+	Accessory *slackButton  `json:"accessory,omitempty"`
+	Elements  []interface{} `json:"elements,omitempty"`
+}
+
+// slackAttachment wraps blocks in a colored bar, which is the only way Slack lets a message carry a color
+type slackAttachment struct {
+	Color  string       `json:"color,omitempty"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+// slackMessage is the rich form of a message.  Attachments are shown below the blocks.
+type slackMessage struct {
+	Blocks      []slackBlock      `json:"blocks,omitempty"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+func headerBlock(text string) slackBlock {
+	return slackBlock{Type: "header", Text: &slackText{Type: "plain_text", Text: truncate(text, slackHeaderLimit), Emoji: true}}
+}
+
+func sectionBlock(text string) slackBlock {
+	return slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncate(text, slackSectionLimit)}}
+}
+
+// contextBlock renders each text as an element of a context block.  Texts past Slack's element limit are joined into
+// the last element.
+func contextBlock(texts ...string) slackBlock {
+	block := slackBlock{Type: "context"}
+	if len(texts) > slackContextElements {
+		texts = append(texts[:slackContextElements-1:slackContextElements-1], strings.Join(texts[slackContextElements-1:], "\n"))
+	}
+	for _, text := range texts {
+		block.Elements = append(block.Elements, slackText{Type: "mrkdwn", Text: truncate(text, slackSectionLimit)})
+	}
+	return block
+}
+
+func actionsBlock(buttons ...*slackButton) slackBlock {
+	block := slackBlock{Type: "actions"}
+	for _, button := range buttons {
+		block.Elements = append(block.Elements, button)
+	}
+	return block
+}
+
+func linkButton(text, actionID, url string) *slackButton {
+	return &slackButton{Type: "button", Text: slackText{Type: "plain_text", Text: text}, ActionID: actionID, URL: url}
+}
+
+// truncate shortens text to at most limit characters, marking that it was cut
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// severityIndicator returns the emoji and attachment color of a stream's findings
+func severityIndicator(stream *releaseReport) (string, string) {
+	switch {
+	case len(stream.unhealthyMessages) == 0:
+		return ":large_green_circle:", colorHealthy
+	case stream.severity == severityLow:
+		return ":large_yellow_circle:", colorLowSeverity
+	default:
+		return ":red_circle:", colorHighSeverity
+	}
+}
+
+// reportPage is the part of a report posted as a single message, in both its Block Kit and text forms
+type reportPage struct {
+	text string
+	rich *slackMessage
+	// how many blocks the rich form holds, counting those inside attachments
+	blocks int
+}
+
+func (p *reportPage) add(text string, attachment slackAttachment) {
+	p.text += text
+	p.rich.Attachments = append(p.rich.Attachments, attachment)
+	p.blocks += len(attachment.Blocks)
+}
+
+// pages renders the report as Block Kit, split on stream boundaries into as many messages as Slack's limits require.
+// The first page starts with a header holding the summary counts and the thresholds and ignored range as context,
+// followed by one colored section per stream with a button opening its release page.  mention, if set, is placed
+// above the streams.
+func (rep *report) pages(o *options, includeHealthy bool, mention string) []*reportPage {
+	numUnhealthy, numLowSeverity := rep.unhealthyCounts()
+	header := fmt.Sprintf("Payload stream health: %d of %d streams unhealthy", numUnhealthy, len(rep.streams))
+	if numLowSeverity > 0 {
+		header += fmt.Sprintf(" (%d low severity)", numLowSeverity)
+	}
+	first := &slackMessage{Blocks: []slackBlock{headerBlock(header)}}
+
+	days := "days"
+	if rep.businessTime {
+		days = "business days"
+	}
+	// upgrade ages are always wall-clock time
+	context := []string{
+		fmt.Sprintf("Accepted within %.1f %s, built within %.1f %s, upgraded within %.1f days", o.acceptedStalenessLimit.Hours()/24, days, o.builtStalenessLimit.Hours()/24, days, o.upgradeStalenessLimit.Hours()/24),
+	}
+	if overrides := rep.phaseLimitsString(o.config, days); overrides != "" {
+		context = append(context, overrides)
+	}
+	context = append(context, fmt.Sprintf("Ignored releases older than 4.%d.z and newer than 4.%d.z", rep.oldestMinor, rep.newestMinor))
+	if rep.lifeCycleSource != nil {
+		context = append(context, fmt.Sprintf("Supported releases from %s", rep.lifeCycleSource))
+	}
+	if rep.selector != nil {
+		context = append(context, fmt.Sprintf("Only streams selected by `%s`", rep.selector))
+	}
+	first.Blocks = append(first.Blocks, contextBlock(context...))
+	text := rep.headerString()
+	if mention != "" {
+		first.Blocks = append(first.Blocks, sectionBlock(mention))
+		text = mention + "\n\n" + text
+	}
+	streams := rep.listedStreams(includeHealthy)
+	if len(streams) == 0 && !includeHealthy {
+		first.Blocks = append(first.Blocks, sectionBlock(":large_green_circle: No unhealthy payload streams detected"))
+		text += "No unhealthy payload streams detected\n"
+	}
+	if removed := rep.removedEdgesString(); removed != "" {
+		first.Blocks = append(first.Blocks, sectionBlock(removed))
+	}
+	if len(rep.freezeNotes) > 0 {
+		first.Blocks = append(first.Blocks, contextBlock(rep.freezeNotes...))
+	}
+
+	page := &reportPage{text: text, rich: first, blocks: len(first.Blocks)}
+	pages := []*reportPage{page}
+	for _, stream := range streams {
+		streamText := rep.streamString(stream, includeHealthy)
+		attachment := rep.streamAttachment(stream, includeHealthy)
+		if len(page.rich.Attachments) > 0 && (len(page.text)+len(streamText) > slackTextLimit || page.blocks+len(attachment.Blocks) > slackBlocksPerMessage) {
+			// leave room for the context block marking the continuation
+			page = &reportPage{rich: &slackMessage{}, blocks: 1}
+			pages = append(pages, page)
+		}
+		page.add(streamText, attachment)
+	}
+	page.text += rep.footerString()
+
+	for i, page := range pages[1:] {
+		page.rich.Blocks = append([]slackBlock{contextBlock(fmt.Sprintf("Payload stream health, continued (%d of %d)", i+2, len(pages)))}, page.rich.Blocks...)
+	}
+	return pages
+}
+
+// phaseLimitsString describes the staleness limits the phase policies override for the phases of the reported streams,
+// or "" if none do
+func (rep *report) phaseLimitsString(cfg *config, days string) string {
+	phases := []string{}
+	for _, streamReport := range rep.streams {
+		if streamReport.phase != "" && !contains(phases, streamReport.phase) {
+			phases = append(phases, streamReport.phase)
+		}
+	}
+	sort.Strings(phases)
+	descriptions := []string{}
+	for _, phase := range phases {
+		policy := cfg.phasePolicy(phase)
+		limits := []string{}
+		if policy.AcceptedStalenessLimit != nil {
+			limits = append(limits, fmt.Sprintf("accepted within %.1f %s", policy.AcceptedStalenessLimit.Hours()/24, days))
+		}
+		if policy.BuiltStalenessLimit != nil {
+			limits = append(limits, fmt.Sprintf("built within %.1f %s", policy.BuiltStalenessLimit.Hours()/24, days))
+		}
+		if policy.UpgradeStalenessLimit != nil {
+			limits = append(limits, fmt.Sprintf("upgraded within %.1f days", policy.UpgradeStalenessLimit.Hours()/24))
+		}
+		if len(limits) > 0 {
+			descriptions = append(descriptions, fmt.Sprintf("%s: %s", phase, strings.Join(limits, ", ")))
+		}
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// streamAttachment renders the findings of a single stream
+func (rep *report) streamAttachment(stream string, includeHealthy bool) slackAttachment {
+	streamReport := rep.streams[stream]
+	emoji, color := severityIndicator(streamReport)
+	title := fmt.Sprintf("%s *%s*", emoji, stream)
+	if streamReport.phase != "" {
+		title += fmt.Sprintf(" (%s)", streamReport.phase)
+	}
+	if streamReport.severity == severityLow && len(streamReport.unhealthyMessages) > 0 {
+		title += " - low severity"
+	}
+
+	lines := []string{title}
+	for i, m := range streamReport.unhealthyMessages {
+		lines = append(lines, "• "+m+streamReport.mention(i))
+	}
+	if streamReport.changelog != nil {
+		lines = append(lines, "• "+streamReport.changelog.summary())
+	}
+	if includeHealthy {
+		for _, m := range streamReport.healthyMessages {
+			lines = append(lines, ":white_check_mark: "+m)
+		}
+	}
+
+	section := sectionBlock(strings.Join(lines, "\n"))
+	section.Accessory = linkButton("Release page", "open-release-page-"+stream, fmt.Sprintf("%s/#%s", rep.releaseAPIUrl, stream))
+	blocks := []slackBlock{section}
+	if streamReport.escalation != "" {
+		blocks = append(blocks, contextBlock(streamReport.escalation))
+	}
+	if streamReport.acknowledgeable {
+		blocks = append(blocks, actionsBlock(ackButton(stream, rep.arch)))
+	}
+	return slackAttachment{Color: color, Blocks: blocks}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	defaultSlackAPIUrl = "https://slack.com/api"
+	// the longest the client waits before retrying a call.  A call Slack asks to wait longer for fails instead, so a
+	// worker is not held up.
+	slackMaxRetryWait = 30 * time.Second
+)
+
+var (
+	// the methods that post something new each time they are called, which are only retried when Slack cannot have
+	// acted on the call: when it is rate limited, or fails before the request is sent
+	nonIdempotentMethods = []string{"chat.postMessage", "files.completeUploadExternal"}
+)
+
+// slackAPIError is an ok:false response from the Slack Web API
+type slackAPIError struct {
+	Method string
+	Code   string
+}
+
+func (e *slackAPIError) Error() string {
+	return fmt.Sprintf("slack %s failed: %s", e.Method, e.Code)
+}
+
+// slackResponse holds the fields common to every Slack Web API response
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// slackClient calls the Slack Web API, retrying rate limited and failed calls
+type slackClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	// how many times a rate limited or failed call is retried
+	maxRetries int
+	// the user id the token belongs to, set by identify
+	userID string
+}
+
+func newSlackClient(baseURL, token string, timeout time.Duration, maxRetries int) *slackClient {
+	return &slackClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: timeout},
+		maxRetries: maxRetries,
+	}
+}
+
+// call posts body as json to a Web API method and decodes the response into into, if set.  ok:false responses are
+// returned as a *slackAPIError.
+func (c *slackClient) call(method string, body interface{}, into interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding slack %s request: %w", method, err)
+	}
+	klog.V(4).Infof("slack %s request: %s", method, payload)
+	return c.do(method, "application/json", payload, into)
+}
+
+// callForm posts form encoded values to a Web API method, for the methods that do not accept json
+func (c *slackClient) callForm(method string, values url.Values, into interface{}) error {
+	return c.do(method, "application/x-www-form-urlencoded", []byte(values.Encode()), into)
+}
+
+func (c *slackClient) do(method, contentType string, payload []byte, into interface{}) error {
+	body, err := c.send(method, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", c.baseURL+"/"+method, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	status := slackResponse{}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("error decoding slack %s response: %w", method, err)
+	}
+	if !status.OK {
+		return &slackAPIError{Method: method, Code: status.Error}
+	}
+	if into != nil {
+		if err := json.Unmarshal(body, into); err != nil {
+			return fmt.Errorf("error decoding slack %s response: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// send sends the request built by newRequest, retrying on network errors, rate limiting and server errors.  Rate
+// limited requests wait as long as the Retry-After header asks, other failures back off exponentially, up to
+// slackMaxRetryWait.  Non-idempotent methods are only retried when rate limited or when the request was never sent,
+// so a message is not posted twice.
+func (c *slackClient) send(method string, newRequest func() (*http.Request, error)) ([]byte, error) {
+	idempotent := !contains(nonIdempotentMethods, method)
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("error generating slack %s request: %w", method, err)
+		}
+		backoff := time.Duration(1<<attempt) * time.Second
+		if backoff > slackMaxRetryWait {
+			backoff = slackMaxRetryWait
+		}
+		// set by the transport's writer, once Slack may have received the request
+		var sent atomic.Bool
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			WroteHeaders: func() { sent.Store(true) },
+		}))
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if attempt < c.maxRetries && (idempotent || !sent.Load()) {
+				klog.Errorf("error calling slack %s, retrying in %s: %v", method, backoff, err)
+				time.Sleep(backoff)
+				continue
+			}
+			return nil, fmt.Errorf("error calling slack %s: %w", method, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading slack %s response: %w", method, err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || (idempotent && resp.StatusCode >= 500) {
+			if resp.StatusCode == http.StatusTooManyRequests {
+				if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+					backoff = time.Duration(seconds) * time.Second
+				}
+			}
+			if attempt < c.maxRetries && backoff <= slackMaxRetryWait {
+				klog.Errorf("slack %s responded with %d, retrying in %s", method, resp.StatusCode, backoff)
+				time.Sleep(backoff)
+				continue
+			}
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("non-OK http response code from slack %s: %d", method, resp.StatusCode)
+		}
+		return body, nil
+	}
+}
+
+type authTestResponse struct {
+	UserID string `json:"user_id"`
+}
+
+// identify looks up the user id the token belongs to, with auth.test
+func (c *slackClient) identify() error {
+	resp := &authTestResponse{}
+	if err := c.call("auth.test", struct{}{}, resp); err != nil {
+		return err
+	}
+	c.userID = resp.UserID
+	klog.V(4).Infof("identified as slack user %s", c.userID)
+	return nil
+}
+
+// postMessage posts a message with chat.postMessage and returns its timestamp
+func (c *slackClient) postMessage(post *PostMessage) (string, error) {
+	resp := &PostMessageResponse{}
+	if err := c.call("chat.postMessage", post, resp); err != nil {
+		return "", err
+	}
+	return resp.TS, nil
+}
+
+// addReaction reacts to a message with the named emoji, with reactions.add
+func (c *slackClient) addReaction(channel, ts, name string) error {
+	return c.call("reactions.add", map[string]string{"channel": channel, "timestamp": ts, "name": name}, nil)
+}
+
+// removeReaction removes a reaction added by the bot, with reactions.remove
+func (c *slackClient) removeReaction(channel, ts, name string) error {
+	return c.call("reactions.remove", map[string]string{"channel": channel, "timestamp": ts, "name": name}, nil)
+}
+
+type uploadURLResponse struct {
+	UploadURL string `json:"upload_url"`
+	FileID    string `json:"file_id"`
+}
+
+type uploadedFile struct {
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+}
+
+type completeUpload struct {
+	Files          []uploadedFile `json:"files"`
+	ChannelID      string         `json:"channel_id"`
+	ThreadTS       string         `json:"thread_ts,omitempty"`
+	InitialComment string         `json:"initial_comment,omitempty"`
+}
+
+// uploadFile uploads content as a text snippet into a thread, using Slack's external upload flow: reserve an upload
+// url, send the content to it, then share the file in the channel
+func (c *slackClient) uploadFile(content, filename, comment, channel, thread string) error {
+	form := url.Values{}
+	form.Set("filename", filename)
+	form.Set("length", strconv.Itoa(len(content)))
+	reserved := &uploadURLResponse{}
+	if err := c.callForm("files.getUploadURLExternal", form, reserved); err != nil {
+		return err
+	}
+
+	if _, err := c.send("file upload", func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", reserved.UploadURL, strings.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "text/markdown")
+		return req, nil
+	}); err != nil {
+		return err
+	}
+
+	return c.call("files.completeUploadExternal", completeUpload{
+		Files:          []uploadedFile{{ID: reserved.FileID, Title: filename}},
+		ChannelID:      channel,
+		ThreadTS:       thread,
+		InitialComment: comment,
+	}, nil)
+}
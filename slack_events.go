@@ -0,0 +1,81 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// a user mention, such as the "<@U0123ABCD>" in the text of an app_mention event, capturing the user id
+	mentionRegex = regexp.MustCompile(`<@([A-Z0-9]+)(\|[^>]*)?>[:,]?\s*`)
+)
+
+// commandEvent returns the command carried by an event, with the mention of the bot stripped from its text, and
+// whether the event carries a command at all.  Commands are either mentions of the bot in a channel or direct
+// messages to it, and an edit of either is treated as a new command.  Events from bots, including this one, never
+// carry a command.
+func (c *slackClient) commandEvent(event Event) (Event, bool) {
+	switch event.Type {
+	case "app_mention":
+	case "message":
+		switch event.Subtype {
+		case "":
+			// mentions in channels also arrive as app_mention events, so only direct messages are handled from here
+			if event.ChannelType != "im" {
+				return event, false
+			}
+		case "message_changed":
+			// Slack does not send app_mention events for edits, so edits of mentions in channels are handled here
+			if event.Message == nil || event.Message.Edited == nil {
+				return event, false
+			}
+			edited := *event.Message
+			edited.Type, edited.Channel, edited.ChannelType = event.Type, event.Channel, event.ChannelType
+			if edited.ChannelType != "im" && !strings.Contains(edited.Text, "<@"+c.userID) {
+				return event, false
+			}
+			event = edited
+		default:
+			// joins, deletions, bot messages and the like
+			return event, false
+		}
+	default:
+		return event, false
+	}
+
+	if event.BotID != "" || event.Subtype == "bot_message" || (c.userID != "" && event.User == c.userID) {
+		return event, false
+	}
+	event.Text = c.stripMentions(strings.TrimSpace(event.Text))
+	return event, true
+}
+
+// stripMentions removes the mentions of the bot from a command, along with any greeting before the first of them, so
+// "hey <@U0123ABCD> report" runs the report command, as does "report <@U0123ABCD>".  Until the bot knows its own id
+// only a leading mention is removed.
+func (c *slackClient) stripMentions(text string) string {
+	if c.userID == "" {
+		if loc := mentionRegex.FindStringIndex(text); loc != nil && loc[0] == 0 {
+			text = text[loc[1]:]
+		}
+		return text
+	}
+	strip := func(text string) string {
+		return strings.TrimSpace(mentionRegex.ReplaceAllStringFunc(text, func(mention string) string {
+			if mentionRegex.FindStringSubmatch(mention)[1] == c.userID {
+				return ""
+			}
+			return mention
+		}))
+	}
+	for _, loc := range mentionRegex.FindAllStringSubmatchIndex(text, -1) {
+		if text[loc[2]:loc[3]] != c.userID {
+			continue
+		}
+		if command := strip(text[loc[0]:]); command != "" {
+			return command
+		}
+		break
+	}
+	return strip(text)
+}
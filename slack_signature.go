@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// requests signed longer ago than this are rejected, so a captured request cannot be replayed later
+	slackSignatureMaxAge = 5 * time.Minute
+)
+
+// verifySlackSignature checks that a request was sent by Slack: its X-Slack-Signature header must be the HMAC-SHA256,
+// keyed by the app's signing secret, of the version, the X-Slack-Request-Timestamp header and the body
+func verifySlackSignature(header http.Header, body []byte, signingSecret string, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("request is not signed")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid request timestamp %q: %w", timestamp, err)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > slackSignatureMaxAge || age < -slackSignatureMaxAge {
+		return fmt.Errorf("request timestamp is %s away from now, more than %s", age.Round(time.Second), slackSignatureMaxAge)
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("request signature does not match")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySlackSignature(t *testing.T) {
+	const (
+		secret    = "secret"
+		body      = "payload=%7B%22type%22%3A%22block_actions%22%7D"
+		timestamp = "1760000000"
+		// the HMAC-SHA256 of "v0:1760000000:" and the body, keyed by the secret
+		signature = "v0=b4cb77e66d879e9a34d4a587820ce8c5b0ca3eee8f012b91c0832db5e4be01a9"
+	)
+	signed := time.Unix(1760000000, 0)
+	headers := func(timestamp, signature string) http.Header {
+		header := http.Header{}
+		if timestamp != "" {
+			header.Set("X-Slack-Request-Timestamp", timestamp)
+		}
+		if signature != "" {
+			header.Set("X-Slack-Signature", signature)
+		}
+		return header
+	}
+	testCases := []struct {
+		name   string
+		header http.Header
+		body   string
+		secret string
+		now    time.Time
+		err    string
+	}{
+		{
+			name:   "valid signature",
+			header: headers(timestamp, signature),
+			body:   body,
+			secret: secret,
+			now:    signed.Add(time.Minute),
+		},
+		{
+			name:   "valid signature from a slightly fast clock",
+			header: headers(timestamp, signature),
+			body:   body,
+			secret: secret,
+			now:    signed.Add(-time.Minute),
+		},
+		{
+			name:   "tampered body",
+			header: headers(timestamp, signature),
+			body:   strings.Replace(body, "block_actions", "view_submission", 1),
+			secret: secret,
+			now:    signed,
+			err:    "signature does not match",
+		},
+		{
+			name:   "wrong secret",
+			header: headers(timestamp, signature),
+			body:   body,
+			secret: "other",
+			now:    signed,
+			err:    "signature does not match",
+		},
+		{
+			name:   "tampered timestamp",
+			header: headers("1760000001", signature),
+			body:   body,
+			secret: secret,
+			now:    signed,
+			err:    "signature does not match",
+		},
+		{
+			name:   "stale timestamp",
+			header: headers(timestamp, signature),
+			body:   body,
+			secret: secret,
+			now:    signed.Add(slackSignatureMaxAge + time.Second),
+			err:    "away from now",
+		},
+		{
+			name:   "timestamp in the future",
+			header: headers(timestamp, signature),
+			body:   body,
+			secret: secret,
+			now:    signed.Add(-slackSignatureMaxAge - time.Second),
+			err:    "away from now",
+		},
+		{
+			name:   "invalid timestamp",
+			header: headers("yesterday", signature),
+			body:   body,
+			secret: secret,
+			now:    signed,
+			err:    "invalid request timestamp",
+		},
+		{
+			name:   "missing signature",
+			header: headers(timestamp, ""),
+			body:   body,
+			secret: secret,
+			now:    signed,
+			err:    "not signed",
+		},
+		{
+			name:   "missing timestamp",
+			header: headers("", signature),
+			body:   body,
+			secret: secret,
+			now:    signed,
+			err:    "not signed",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifySlackSignature(tc.header, []byte(tc.body), tc.secret, tc.now)
+			if tc.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// Slack only shows the first few thousand characters of a message before collapsing it, so longer text is split
+	// over several thread replies
+	slackTextLimit = 3500
+	// text longer than this is uploaded as a file into the thread rather than posted as a long series of replies
+	slackUploadCutoff = 5 * slackTextLimit
+)
+
+// splitText splits text into chunks of at most limit bytes, breaking on blank lines, which separate the streams of a
+// report, then on line ends, and only cutting lines that are longer than limit on their own
+func splitText(text string, limit int) []string {
+	chunks := []string{}
+	current := ""
+	flush := func() {
+		if strings.TrimSpace(current) != "" {
+			chunks = append(chunks, current)
+		}
+		current = ""
+	}
+	add := func(piece string) {
+		if len(current)+len(piece) > limit {
+			flush()
+		}
+		for len(piece) > limit {
+			// cut at a rune boundary so no multi-byte character is split across chunks
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(piece[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = limit
+			}
+			chunks = append(chunks, piece[:cut])
+			piece = piece[cut:]
+		}
+		current += piece
+	}
+	for _, paragraph := range strings.SplitAfter(text, "\n\n") {
+		if len(paragraph) <= limit {
+			add(paragraph)
+			continue
+		}
+		for _, line := range strings.SplitAfter(paragraph, "\n") {
+			add(line)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// sendLongMessage posts text into a thread, split into as many replies as needed, or uploads it as a file when it is
+// too long to read as replies.  comment introduces the file.
+func (c *slackClient) sendLongMessage(text, comment, channel, thread string) error {
+	if len(text) > slackUploadCutoff {
+		return c.uploadFile(text, "report.md", comment, channel, thread)
+	}
+	for _, chunk := range splitText(text, slackTextLimit) {
+		if _, err := c.sendMessage(chunk, channel, thread); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendReportPages posts each page of a report as a thread reply, or uploads the text form of the whole report as a
+// file when it is too long to read as replies
+func (c *slackClient) sendReportPages(pages []*reportPage, text, comment, channel, thread string) error {
+	if len(text) > slackUploadCutoff {
+		return c.uploadFile(text, "report.md", comment, channel, thread)
+	}
+	for _, page := range pages {
+		if _, err := c.sendRichMessage(page.rich, page.text, channel, thread); err != nil {
+			return err
+		}
+	}
+	return nil
+}
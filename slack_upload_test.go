@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		limit    int
+		expected []string
+	}{
+		{
+			name:     "empty",
+			text:     "",
+			limit:    10,
+			expected: []string{},
+		},
+		{
+			name:     "within the limit",
+			text:     "short",
+			limit:    10,
+			expected: []string{"short"},
+		},
+		{
+			name:     "exactly the limit",
+			text:     "0123456789",
+			limit:    10,
+			expected: []string{"0123456789"},
+		},
+		{
+			name:     "paragraphs are kept together",
+			text:     "aaaa\n\nbbbb\n\ncccc",
+			limit:    12,
+			expected: []string{"aaaa\n\nbbbb\n\n", "cccc"},
+		},
+		{
+			name:     "long paragraphs are broken on line ends",
+			text:     "aaaa\nbbbb\ncccc\n\ndd",
+			limit:    10,
+			expected: []string{"aaaa\nbbbb\n", "cccc\n\ndd"},
+		},
+		{
+			name:     "long lines are cut at the limit",
+			text:     "abcdefghij",
+			limit:    4,
+			expected: []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:     "two byte runes are not split",
+			text:     "ééééé",
+			limit:    3,
+			expected: []string{"é", "é", "é", "é", "é"},
+		},
+		{
+			name:     "two byte runes fill the limit",
+			text:     "ééééé",
+			limit:    4,
+			expected: []string{"éé", "éé", "é"},
+		},
+		{
+			name:     "three byte runes are not split",
+			text:     "€€€",
+			limit:    4,
+			expected: []string{"€", "€", "€"},
+		},
+		{
+			name:     "whitespace only chunks are dropped",
+			text:     "aaaa\n\n\n\n",
+			limit:    4,
+			expected: []string{"aaaa"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			chunks := splitText(tc.text, tc.limit)
+			if !reflect.DeepEqual(chunks, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, chunks)
+			}
+			for _, chunk := range chunks {
+				if len(chunk) > tc.limit {
+					t.Errorf("chunk %q is longer than %d bytes", chunk, tc.limit)
+				}
+				if !utf8.ValidString(chunk) {
+					t.Errorf("chunk %q is not valid UTF-8", chunk)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	staleLikelyNoChanges    = "likely no changes"
+	staleLikelyInfraFailure = "likely build infrastructure failure"
+	staleUnknown            = "unknown"
+)
+
+var (
+	// the build type portion of a stream name, e.g. "0-0.nightly" in "4.16.0-0.nightly-arm64"
+	streamTypeRegex = regexp.MustCompile(`0-0\.(ci|nightly)`)
+)
+
+// stalenessEvidence collects the observations that point towards a stale build stream either simply having no new code
+// to build, or having a broken build system.
+type stalenessEvidence struct {
+	infraFailure []string
+	noChanges    []string
+}
+
+// classification weighs the evidence, which is unknown when there is none or it is evenly split
+func (e *stalenessEvidence) classification() string {
+	switch {
+	case len(e.infraFailure) > len(e.noChanges):
+		return staleLikelyInfraFailure
+	case len(e.noChanges) > len(e.infraFailure):
+		return staleLikelyNoChanges
+	default:
+		return staleUnknown
+	}
+}
+
+func (e *stalenessEvidence) String() string {
+	observations := append(append([]string{}, e.infraFailure...), e.noChanges...)
+	if len(observations) == 0 {
+		return e.classification()
+	}
+	return fmt.Sprintf("%s: %s", e.classification(), strings.Join(observations, "; "))
+}
+
+// stalenessClassifier gathers evidence about stale build streams from the stream itself, its matching ci/nightly
+// stream, and the same stream on the sibling architectures.
+type stalenessClassifier struct {
+	arch          string
+	releaseAPIUrl string
+	allReleases   map[string][]string
+	// all payloads of the sibling architectures, fetched on first use
+	siblings map[string]map[string][]string
+}
+
+func newStalenessClassifier(arch, releaseAPIUrl string, allReleases map[string][]string) *stalenessClassifier {
+	return &stalenessClassifier{
+		arch:          arch,
+		releaseAPIUrl: releaseAPIUrl,
+		allReleases:   allReleases,
+	}
+}
+
+// matchingStream returns the nightly stream for a ci stream and vice versa
+func matchingStream(stream string) string {
+	return streamTypeRegex.ReplaceAllStringFunc(stream, func(t string) string {
+		if t == "0-0.ci" {
+			return "0-0.nightly"
+		}
+		return "0-0.ci"
+	})
+}
+
+// siblingStream translates a stream name between architectures.  Streams on amd64 carry no suffix, every other
+// architecture suffixes its streams with the architecture name (e.g. 4.16.0-0.nightly-arm64).
+func siblingStream(stream, fromArch, toArch string) string {
+	if fromArch != "amd64" {
+		stream = strings.TrimSuffix(stream, "-"+fromArch)
+	}
+	if toArch != "amd64" {
+		stream += "-" + toArch
+	}
+	return stream
+}
+
+// newestPayloads returns the payloads ordered from newest to oldest, skipping any without a parsable timestamp
+func newestPayloads(payloads []string) ([]string, []time.Time) {
+	type payloadTime struct {
+		name string
+		ts   time.Time
+	}
+	sorted := []payloadTime{}
+	for _, payload := range payloads {
+		ts, err := getPayloadTimestamp(payload)
+		if err != nil {
+			continue
+		}
+		sorted = append(sorted, payloadTime{name: payload, ts: ts})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ts.After(sorted[j].ts) })
+	names := make([]string, 0, len(sorted))
+	times := make([]time.Time, 0, len(sorted))
+	for _, p := range sorted {
+		names = append(names, p.name)
+		times = append(times, p.ts)
+	}
+	return names, times
+}
+
+func (c *stalenessClassifier) siblingReleases() map[string]map[string][]string {
+	if c.siblings != nil {
+		return c.siblings
+	}
+	c.siblings = make(map[string]map[string][]string)
+	for arch, url := range releaseAPIUrls {
+		if arch == c.arch {
+			continue
+		}
+		releases, err := getReleaseStream(url + allReleasePath)
+		if err != nil {
+			klog.Errorf("unable to get %s payloads to classify stale streams: %v", arch, err)
+			continue
+		}
+		c.siblings[arch] = releases
+	}
+	return c.siblings
+}
+
+// classify gathers the evidence about a stale stream, counting payloads built within threshold as recent
+func (c *stalenessClassifier) classify(stream string, threshold time.Duration) *stalenessEvidence {
+	evidence := &stalenessEvidence{}
+	now := time.Now()
+	_, times := newestPayloads(c.allReleases[stream])
+	var newest time.Time
+	if len(times) > 0 {
+		newest = times[0]
+	}
+
+	matching := matchingStream(stream)
+	if _, ok := c.allReleases[matching]; ok {
+		_, matchingTimes := newestPayloads(c.allReleases[matching])
+		if len(matchingTimes) > 0 && matchingTimes[0].After(newest) && now.Sub(matchingTimes[0]) < threshold {
+			evidence.infraFailure = append(evidence.infraFailure, fmt.Sprintf("%s built a payload %.1f days ago", matching, now.Sub(matchingTimes[0]).Hours()/24))
+		} else {
+			evidence.noChanges = append(evidence.noChanges, fmt.Sprintf("%s has no newer recent payloads either", matching))
+		}
+	}
+
+	// identical newest payloads show the stream had run out of changes to build.  Payloads that differ only show that
+	// changes landed before the last build, which says nothing about why there was no build since.
+	if names, _ := newestPayloads(c.allReleases[stream]); len(names) >= 2 {
+		changelog, err := getChangelog(c.releaseAPIUrl, names[1], names[0])
+		if err != nil {
+			klog.Errorf("unable to compare the newest payloads of %s: %v", stream, err)
+		} else {
+			commits := 0
+			for _, image := range changelog.UpdatedImages {
+				commits += len(image.Commits)
+			}
+			for _, image := range changelog.NewImages {
+				commits += len(image.Commits)
+			}
+			if commits == 0 {
+				evidence.noChanges = append(evidence.noChanges, "the two newest payloads have identical content")
+			}
+		}
+	}
+
+	siblings := c.siblingReleases()
+	arches := []string{}
+	for arch := range siblings {
+		arches = append(arches, arch)
+	}
+	sort.Strings(arches)
+	siblingsChecked, siblingsFresh := 0, 0
+	for _, arch := range arches {
+		sibling := siblingStream(stream, c.arch, arch)
+		payloads, ok := siblings[arch][sibling]
+		if !ok {
+			continue
+		}
+		siblingsChecked++
+		_, siblingTimes := newestPayloads(payloads)
+		if len(siblingTimes) > 0 && now.Sub(siblingTimes[0]) < threshold {
+			siblingsFresh++
+			evidence.infraFailure = append(evidence.infraFailure, fmt.Sprintf("%s built a payload %.1f days ago", sibling, now.Sub(siblingTimes[0]).Hours()/24))
+		}
+	}
+	if siblingsChecked > 0 && siblingsFresh == 0 {
+		evidence.noChanges = append(evidence.noChanges, "no sibling architecture has built a recent payload either")
+	}
+	return evidence
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// a range of minors, e.g. "4.14-4.16"
+	minorRangeRegex = regexp.MustCompile(`^4\.([0-9]+)-4\.([0-9]+)$`)
+	// a z-stream name, optionally suffixed with an architecture, e.g. "4.17.0-0.ci" or "4.16.0-0.nightly-arm64"
+	streamNameRegex = regexp.MustCompile(`^4\.[0-9]+\.0-0\.(ci|nightly)(-[a-z0-9]+)?$`)
+)
+
+// streamSelector selects the release streams to report on.  It is written as comma separated terms: terms of the
+// same kind are alternatives, and terms of different kinds must all match.  The kinds are:
+//
+//   - minors: "4.16", "4.14-4.16", "supported" (minors that have shipped), "development" (minors that have not
+//     shipped yet) and "eus" (minors in the Extended Update Support phases of the life-cycle data)
+//   - stream types: "nightly" or "ci"
+//   - streams: a stream name such as "4.17.0-0.ci", or a regular expression between slashes such as "/^4\.1[46]/"
+//
+// So "4.14,4.16" selects every stream of 4.14 and 4.16, and "eus,nightly" selects the nightly streams of the minors in
+// Extended Update Support.  A nil selector selects every stream.
+type streamSelector struct {
+	expression string
+	minors     []func(minor int, phase string) bool
+	types      map[string]struct{}
+	streams    []*regexp.Regexp
+	// the oldest and newest of the minors named by minor, range and stream name terms, -1 if none are
+	oldestNamed int
+	newestNamed int
+}
+
+// parseStreamSelector parses a selector expression, returning nil for an empty expression
+func parseStreamSelector(expression string) (*streamSelector, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+	s := &streamSelector{expression: expression, types: make(map[string]struct{}), oldestNamed: -1, newestNamed: -1}
+	for _, term := range splitSelectorTerms(expression) {
+		term = strings.TrimSpace(term)
+		switch {
+		case term == "":
+			return nil, fmt.Errorf("empty term in stream selector %q", expression)
+		case term == "nightly" || term == "ci":
+			s.types[term] = struct{}{}
+		case term == "supported":
+			s.minors = append(s.minors, func(minor int, phase string) bool {
+				return phase != cadencePhaseDevelopment && phase != phasePreGA
+			})
+		case term == "development":
+			s.minors = append(s.minors, func(minor int, phase string) bool {
+				return phase == cadencePhaseDevelopment || phase == phasePreGA
+			})
+		case term == "eus":
+			s.minors = append(s.minors, func(minor int, phase string) bool { return phase == phaseEUS || phase == phaseEUSTerm2 })
+		case minorOnlyRegex.MatchString(term):
+			selected, _ := strconv.Atoi(minorOnlyRegex.FindStringSubmatch(term)[1])
+			s.name(selected, selected)
+			s.minors = append(s.minors, func(minor int, phase string) bool { return minor == selected })
+		case minorRangeRegex.MatchString(term):
+			m := minorRangeRegex.FindStringSubmatch(term)
+			oldest, _ := strconv.Atoi(m[1])
+			newest, _ := strconv.Atoi(m[2])
+			if newest < oldest {
+				return nil, fmt.Errorf("minor range %q in stream selector %q is reversed", term, expression)
+			}
+			s.name(oldest, newest)
+			s.minors = append(s.minors, func(minor int, phase string) bool { return minor >= oldest && minor <= newest })
+		case streamNameRegex.MatchString(term):
+			// a name without an architecture suffix selects the stream on whichever architecture is reported on
+			if minor := streamMinor(term); minor != -1 {
+				s.name(minor, minor)
+			}
+			pattern := "^" + regexp.QuoteMeta(term)
+			if streamNameRegex.FindStringSubmatch(term)[2] == "" {
+				pattern += "(-[a-z0-9]+)?"
+			}
+			s.streams = append(s.streams, regexp.MustCompile(pattern+"$"))
+		case len(term) > 1 && strings.HasPrefix(term, "/") && strings.HasSuffix(term, "/"):
+			re, err := regexp.Compile(term[1 : len(term)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q in stream selector %q: %w", term, expression, err)
+			}
+			s.streams = append(s.streams, re)
+		default:
+			return nil, fmt.Errorf("unknown term %q in stream selector %q, expected a minor such as 4.16, a range such as 4.14-4.16, supported, development, eus, nightly, ci, a stream name or a /regular expression/", term, expression)
+		}
+	}
+	return s, nil
+}
+
+// splitSelectorTerms splits an expression on the commas outside of regular expressions
+func splitSelectorTerms(expression string) []string {
+	terms := []string{}
+	start := 0
+	inRegex := false
+	for i, r := range expression {
+		switch {
+		case r == '/' && (inRegex || strings.TrimSpace(expression[start:i]) == ""):
+			inRegex = !inRegex
+		case r == ',' && !inRegex:
+			terms = append(terms, expression[start:i])
+			start = i + 1
+		}
+	}
+	return append(terms, expression[start:])
+}
+
+// name records minors named explicitly by a term
+func (s *streamSelector) name(oldest, newest int) {
+	if s.oldestNamed == -1 || oldest < s.oldestNamed {
+		s.oldestNamed = oldest
+	}
+	if newest > s.newestNamed {
+		s.newestNamed = newest
+	}
+}
+
+// namedMinors returns the oldest and newest of the minors the selector names explicitly, and whether it names any
+func (s *streamSelector) namedMinors() (int, int, bool) {
+	if s == nil || s.oldestNamed == -1 {
+		return -1, -1, false
+	}
+	return s.oldestNamed, s.newestNamed, true
+}
+
+// selectsMinor reports whether the minor terms of the selector allow the minor
+func (s *streamSelector) selectsMinor(minor int, phase string) bool {
+	if s == nil || len(s.minors) == 0 {
+		return true
+	}
+	for _, selects := range s.minors {
+		if selects(minor, phase) {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictsStreams reports whether the selector names stream types or streams, so it only selects some z-streams
+func (s *streamSelector) restrictsStreams() bool {
+	return s != nil && (len(s.types) > 0 || len(s.streams) > 0)
+}
+
+// matches reports whether the selector selects a z-stream, given the life-cycle phase of each minor
+func (s *streamSelector) matches(stream string, phases map[int]string) bool {
+	if s == nil {
+		return true
+	}
+	minor := streamMinor(stream)
+	if !s.selectsMinor(minor, phases[minor]) {
+		return false
+	}
+	if len(s.types) > 0 {
+		m := streamTypeRegex.FindStringSubmatch(stream)
+		if m == nil {
+			return false
+		}
+		if _, ok := s.types[m[1]]; !ok {
+			return false
+		}
+	}
+	if len(s.streams) > 0 {
+		matched := false
+		for _, re := range s.streams {
+			if re.MatchString(stream) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *streamSelector) String() string {
+	if s == nil {
+		return "all streams"
+	}
+	return s.expression
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSelectorTerms(t *testing.T) {
+	testCases := []struct {
+		name       string
+		expression string
+		expected   []string
+	}{
+		{
+			name:       "single term",
+			expression: "4.16",
+			expected:   []string{"4.16"},
+		},
+		{
+			name:       "comma separated terms",
+			expression: "4.14, 4.16,nightly",
+			expected:   []string{"4.14", " 4.16", "nightly"},
+		},
+		{
+			name:       "commas inside a regular expression",
+			expression: `/^4\.1{1,2}/,nightly`,
+			expected:   []string{`/^4\.1{1,2}/`, "nightly"},
+		},
+		{
+			name:       "regular expression after other terms",
+			expression: `nightly, /4\.(14|16){1,}/`,
+			expected:   []string{"nightly", ` /4\.(14|16){1,}/`},
+		},
+		{
+			name:       "slashes inside a term are not a regular expression",
+			expression: "a/b,c",
+			expected:   []string{"a/b", "c"},
+		},
+		{
+			name:       "empty terms are kept",
+			expression: "4.16,,ci",
+			expected:   []string{"4.16", "", "ci"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if terms := splitSelectorTerms(tc.expression); !reflect.DeepEqual(terms, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, terms)
+			}
+		})
+	}
+}
+
+func TestParseStreamSelector(t *testing.T) {
+	phases := map[int]string{
+		12: phaseEUSTerm2,
+		14: phaseEUS,
+		15: phaseMaintenanceSupport,
+		16: phaseFullSupport,
+		17: phaseFullSupport,
+		18: cadencePhaseDevelopment,
+	}
+	testCases := []struct {
+		name       string
+		expression string
+		selected   []string
+		unselected []string
+		named      []int
+		err        string
+	}{
+		{
+			name:       "empty selects everything",
+			expression: " ",
+			selected:   []string{"4.16.0-0.nightly", "4.18.0-0.ci"},
+		},
+		{
+			name:       "minors are alternatives",
+			expression: "4.14,4.16",
+			selected:   []string{"4.14.0-0.nightly", "4.16.0-0.ci"},
+			unselected: []string{"4.15.0-0.nightly"},
+			named:      []int{14, 16},
+		},
+		{
+			name:       "range and type must both match",
+			expression: "4.14-4.16,nightly",
+			selected:   []string{"4.15.0-0.nightly", "4.16.0-0.nightly-arm64"},
+			unselected: []string{"4.15.0-0.ci", "4.17.0-0.nightly"},
+			named:      []int{14, 16},
+		},
+		{
+			name:       "eus follows the life-cycle phase",
+			expression: "eus",
+			selected:   []string{"4.12.0-0.nightly", "4.14.0-0.ci"},
+			unselected: []string{"4.16.0-0.nightly", "4.15.0-0.nightly"},
+		},
+		{
+			name:       "development follows the life-cycle phase",
+			expression: "development",
+			selected:   []string{"4.18.0-0.nightly"},
+			unselected: []string{"4.17.0-0.nightly"},
+		},
+		{
+			name:       "stream name without an architecture matches every architecture",
+			expression: "4.17.0-0.ci",
+			selected:   []string{"4.17.0-0.ci", "4.17.0-0.ci-arm64"},
+			unselected: []string{"4.17.0-0.nightly", "4.16.0-0.ci"},
+			named:      []int{17, 17},
+		},
+		{
+			name:       "stream name with an architecture",
+			expression: "4.17.0-0.ci-arm64",
+			selected:   []string{"4.17.0-0.ci-arm64"},
+			unselected: []string{"4.17.0-0.ci"},
+			named:      []int{17, 17},
+		},
+		{
+			name:       "regular expression with a comma",
+			expression: `/^4\.1[46]\.0-0\.(ci|nightly){1,2}$/`,
+			selected:   []string{"4.14.0-0.ci", "4.16.0-0.nightly"},
+			unselected: []string{"4.15.0-0.ci", "4.16.0-0.nightly-arm64"},
+		},
+		{
+			name:       "empty term",
+			expression: "4.16,,ci",
+			err:        "empty term",
+		},
+		{
+			name:       "reversed range",
+			expression: "4.16-4.14",
+			err:        "is reversed",
+		},
+		{
+			name:       "invalid regular expression",
+			expression: "/4.1[/",
+			err:        "invalid regular expression",
+		},
+		{
+			name:       "unknown term",
+			expression: "stable",
+			err:        "unknown term",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selector, err := parseStreamSelector(tc.expression)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected an error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, stream := range tc.selected {
+				if !selector.matches(stream, phases) {
+					t.Errorf("expected %s to be selected", stream)
+				}
+			}
+			for _, stream := range tc.unselected {
+				if selector.matches(stream, phases) {
+					t.Errorf("expected %s not to be selected", stream)
+				}
+			}
+			oldest, newest, ok := selector.namedMinors()
+			if named := []int{oldest, newest}; ok != (tc.named != nil) || (ok && !reflect.DeepEqual(named, tc.named)) {
+				t.Errorf("expected the named minors %v, got %v", tc.named, named)
+			}
+		})
+	}
+}
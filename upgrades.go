@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// the architecture suffix of the named releases of the multi and single-arch release controllers that carry one,
+	// e.g. "-multi" in 4.16.5-multi
+	releaseArchSuffix = `(?:-(?:multi|x86_64|aarch64|ppc64le|s390x))?`
+)
+
+var (
+	// a generally available z release, e.g. 4.15.23 or 4.15.23-multi
+	gaVersionRegex = regexp.MustCompile(`^4\.([0-9]+)\.([0-9]+)` + releaseArchSuffix + `$`)
+)
+
+// upgradePathStatus tracks the recent upgrades of a stream along one required upgrade path
+type upgradePathStatus struct {
+	path *upgradePath
+	// the exact version the upgrade must come from, empty if any version of the source minor is accepted
+	source   string
+	attempts *upgradeAttempts
+	found    *found
+}
+
+// description names the path and its source for the report, e.g. "minor level upgrade from the latest 4.15.z (4.15.23)"
+func (s *upgradePathStatus) description(minor int) string {
+	description := s.path.Name + " upgrade"
+	switch {
+	case s.source != "":
+		description += fmt.Sprintf(" from the latest 4.%d.z (%s)", minor-s.path.MinorOffset, s.source)
+	case s.path.MinorOffset > 0:
+		description += fmt.Sprintf(" from 4.%d", minor-s.path.MinorOffset)
+	}
+	return description
+}
+
+// latestGAVersions returns the newest generally available z release of each minor that appears in the graphs
+func latestGAVersions(graphs ...GraphMap) map[int]string {
+	latest := make(map[int]string)
+	latestZ := make(map[int]int)
+	consider := func(version string) {
+		m := gaVersionRegex.FindStringSubmatch(version)
+		if m == nil {
+			return
+		}
+		minor, _ := strconv.Atoi(m[1])
+		z, _ := strconv.Atoi(m[2])
+		if current, ok := latestZ[minor]; !ok || z > current {
+			latestZ[minor] = z
+			latest[minor] = version
+		}
+	}
+	for _, graph := range graphs {
+		for to, froms := range graph {
+			consider(to)
+			for _, from := range froms {
+				consider(from)
+			}
+		}
+	}
+	return latest
+}
+
+// getUpgradeGraphs returns the stable graph, which only includes successful edges, and the merged nightly and
+// prerelease graphs, which include edges for any upgrade attempt that was made regardless of whether the job passed.
+// Having both lets us tell upgrades that were never attempted apart from those that failed.
+func getUpgradeGraphs(releaseAPIUrl string) (GraphMap, GraphMap, error) {
+	stableGraph, err := getUpgradeGraph(releaseAPIUrl, "stable")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attemptedGraph := GraphMap{}
+	for _, channel := range []string{"nightly", "prerelease"} {
+		graph, err := getUpgradeGraph(releaseAPIUrl, channel)
+		if err != nil {
+			klog.Errorf("unable to get upgrade attempts from the %s graph: %v", channel, err)
+			continue
+		}
+		for to, froms := range graph {
+			attemptedGraph[to] = append(attemptedGraph[to], froms...)
+		}
+	}
+	return stableGraph, attemptedGraph, nil
+}
+
+// upgradeResult is a single run of an upgrade job into a payload
+type upgradeResult struct {
+	from      string
+	succeeded bool
+	ran       time.Time
+	url       string
+}
+
+// getUpgradeResults returns the upgrade job runs into a payload, using the times at which the release controller
+// recorded each result.  When the results are unavailable or carry no timestamps, the edges of the graphs are used
+// instead, dated with the age of the payload itself.  Each call costs a request to the release controller, so callers
+// bound the payloads they ask about.
+func getUpgradeResults(releaseAPIUrl, stream, payload string, graph, attemptedGraph GraphMap) []upgradeResult {
+	if len(graph[payload]) == 0 && len(attemptedGraph[payload]) == 0 {
+		return nil
+	}
+
+	info, err := getReleaseInfo(releaseAPIUrl, stream, payload)
+	if err != nil {
+		klog.Errorf("unable to get upgrade results for %s, falling back to the payload age: %v", payload, err)
+	} else {
+		results := []upgradeResult{}
+		for _, history := range info.UpgradesTo {
+			if history.To != payload {
+				continue
+			}
+			for _, result := range history.History {
+				if result.Timestamp == 0 {
+					continue
+				}
+				results = append(results, upgradeResult{
+					from:      history.From,
+					succeeded: result.State == jobStateSucceeded,
+					ran:       time.Unix(result.Timestamp, 0),
+					url:       result.URL,
+				})
+			}
+		}
+		if len(results) > 0 {
+			return results
+		}
+	}
+
+	ts, err := getPayloadTimestamp(payload)
+	if err != nil {
+		klog.Error(err.Error())
+		return nil
+	}
+	// every successful edge is also an attempt, even if it is missing from the attempted graph
+	attempted := make(map[string]bool)
+	for _, from := range attemptedGraph[payload] {
+		attempted[from] = false
+	}
+	for _, from := range graph[payload] {
+		attempted[from] = true
+	}
+	results := []upgradeResult{}
+	for from, succeeded := range attempted {
+		results = append(results, upgradeResult{from: from, succeeded: succeeded, ran: ts})
+	}
+	return results
+}